@@ -0,0 +1,516 @@
+package main
+
+// artwork conformance: make the podcast's artwork meet the Apple Podcasts requirements
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif" // register the GIF decoder, so GIF artwork can be converted
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	jpegQualityMax  = 90
+	jpegQualityMin  = 60
+	jpegQualityStep = 5
+)
+
+// Artwork is the podcast's artwork, as it is saved in output_dir, and
+// embedded in the tracks
+type Artwork struct {
+	Name     string
+	MimeType string
+	Data     []byte
+	Width    int
+	Height   int
+}
+
+// pngChunks are the PNG chunks kept when stripping metadata: the critical
+// chunks (which start with an upper case letter), and those affecting how
+// the image is displayed
+var pngChunks = map[string]bool{
+	"bKGD": true,
+	"cHRM": true,
+	"gAMA": true,
+	"iCCP": true,
+	"sBIT": true,
+	"sRGB": true,
+	"tRNS": true,
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// parseColor parses a "#rrggbb" color
+func parseColor(s string) (c color.RGBA, err error) {
+	s = strings.TrimPrefix(s, "#")
+	if len(s) != 6 {
+		return c, fmt.Errorf("%q is not a #rrggbb color", s)
+	}
+	rgb, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return c, fmt.Errorf("%q is not a #rrggbb color", s)
+	}
+	return color.RGBA{R: uint8(rgb >> 16), G: uint8(rgb >> 8), B: uint8(rgb), A: 0xff}, nil
+}
+
+// parseSize parses a file size, such as 524288, 512KB or 1MB
+func parseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix     string
+		multiplier int64
+	}{{"KB", 1 << 10}, {"MB", 1 << 20}, {"K", 1 << 10}, {"M", 1 << 20}, {"B", 1}} {
+		if strings.HasSuffix(s, unit.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%q is not a file size", s)
+	}
+	return n * multiplier, nil
+}
+
+// rgbModel returns true if m is an RGB color model
+func rgbModel(m color.Model) bool {
+	switch m {
+	case color.CMYKModel, color.GrayModel, color.Gray16Model:
+		return false
+	}
+	return true
+}
+
+// conformImage returns the artwork in filename, converted, if needed, to a
+// square RGB JPEG or PNG between 1400x1400 and 3000x3000 pixels, of no more
+// than image_size_max bytes, without any metadata
+func conformImage(filename string) (*Artwork, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	var reasons []string
+	if format != "jpeg" && format != "png" {
+		reasons = append(reasons, "not a JPEG or PNG")
+	}
+	if config.Width != config.Height {
+		reasons = append(reasons, "not square")
+	}
+	if config.Width < imageWidthMin || config.Width > imageWidthMax ||
+		config.Height < imageHeightMin || config.Height > imageHeightMax {
+		reasons = append(reasons, fmt.Sprintf("not between %dx%d and %dx%d",
+			imageWidthMin, imageHeightMin, imageWidthMax, imageHeightMax))
+	}
+	if !rgbModel(config.ColorModel) {
+		reasons = append(reasons, "not RGB")
+	}
+
+	if len(reasons) == 0 {
+		var stripped []byte
+		if format == "jpeg" {
+			stripped, err = stripJPEG(data)
+		} else {
+			stripped, err = stripPNG(data)
+		}
+		if err != nil {
+			reasons = append(reasons, fmt.Sprintf("cannot strip its metadata: %s", err))
+		} else if int64(len(stripped)) > defaults.imageSizeMax {
+			reasons = append(reasons, fmt.Sprintf("it is %d bytes, more than %d", len(stripped), defaults.imageSizeMax))
+		} else {
+			if len(stripped) < len(data) {
+				log.Debugf("Stripped %d bytes of metadata from %q", len(data)-len(stripped), filename)
+			}
+			return &Artwork{
+				Name:     path.Base(filename),
+				MimeType: "image/" + format,
+				Data:     stripped,
+				Width:    config.Width,
+				Height:   config.Height,
+			}, nil
+		}
+	}
+
+	log.Infof("Converting %q, a %dx%d %s image: %s", filename, config.Width, config.Height, format, strings.Join(reasons, ", "))
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return encodeArtwork(squareImage(img), basename(path.Base(filename)), format == "png")
+}
+
+// squareImage crops img to a square, or pads it, per image_fit, replaces its
+// transparency with image_pad_color, and scales it to between 1400x1400 and
+// 3000x3000 pixels
+func squareImage(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	var canvas *image.RGBA
+	if defaults.ImageFit == "pad" {
+		side := b.Dx()
+		if b.Dy() > side {
+			side = b.Dy()
+		}
+		canvas = image.NewRGBA(image.Rect(0, 0, side, side))
+		draw.Draw(canvas, canvas.Bounds(), image.NewUniform(defaults.imagePadColor), image.Point{}, draw.Src)
+		offset := image.Pt((side-b.Dx())/2, (side-b.Dy())/2)
+		draw.Draw(canvas, b.Sub(b.Min).Add(offset), img, b.Min, draw.Over)
+	} else {
+		side := b.Dx()
+		if b.Dy() < side {
+			side = b.Dy()
+		}
+		canvas = image.NewRGBA(image.Rect(0, 0, side, side))
+		draw.Draw(canvas, canvas.Bounds(), image.NewUniform(defaults.imagePadColor), image.Point{}, draw.Src)
+		origin := b.Min.Add(image.Pt((b.Dx()-side)/2, (b.Dy()-side)/2))
+		draw.Draw(canvas, canvas.Bounds(), img, origin, draw.Over)
+	}
+
+	side := canvas.Bounds().Dx()
+	switch {
+	case side < imageWidthMin:
+		return resize(canvas, imageWidthMin, imageHeightMin)
+	case side > imageWidthMax:
+		return resize(canvas, imageWidthMax, imageHeightMax)
+	}
+	return canvas
+}
+
+// encodeArtwork encodes img, which squareImage made opaque, as a PNG, if asPNG
+// is set, and it fits in image_size_max, or else as a JPEG, lowering the
+// quality, and then the size, until it fits
+func encodeArtwork(img *image.RGBA, name string, asPNG bool) (*Artwork, error) {
+	var buf bytes.Buffer
+	if asPNG {
+		err := png.Encode(&buf, img)
+		if err != nil {
+			return nil, err
+		}
+		if int64(buf.Len()) <= defaults.imageSizeMax {
+			side := img.Bounds().Dx()
+			return &Artwork{Name: name + ".png", MimeType: "image/png", Data: buf.Bytes(), Width: side, Height: side}, nil
+		}
+		log.Debugf("%q is %d bytes as a PNG, converting it to a JPEG", name, buf.Len())
+	}
+
+	scaled := img
+	for {
+		side := scaled.Bounds().Dx()
+		for quality := jpegQualityMax; quality >= jpegQualityMin; quality -= jpegQualityStep {
+			buf.Reset()
+			err := jpeg.Encode(&buf, scaled, &jpeg.Options{Quality: quality})
+			if err != nil {
+				return nil, err
+			}
+			if int64(buf.Len()) <= defaults.imageSizeMax {
+				log.Debugf("Encoded %q as a %dx%d JPEG, at quality %d", name, side, side, quality)
+				return &Artwork{Name: name + ".jpg", MimeType: "image/jpeg", Data: buf.Bytes(), Width: side, Height: side}, nil
+			}
+		}
+		if side <= imageWidthMin {
+			log.Warnf("Cannot fit %q in %d bytes, it is %d bytes", name, defaults.imageSizeMax, buf.Len())
+			return &Artwork{Name: name + ".jpg", MimeType: "image/jpeg", Data: buf.Bytes(), Width: side, Height: side}, nil
+		}
+		side = side * 9 / 10
+		if side < imageWidthMin {
+			side = imageWidthMin
+		}
+		scaled = resize(img, side, side)
+	}
+}
+
+// contribution is the weight of a source pixel in a resized pixel
+type contribution struct {
+	index  int
+	weight float64
+}
+
+// resampleWeights returns the source pixels, and their weights, of each of
+// the n pixels resized from srcN pixels: the average of the pixels covered
+// when shrinking, and bilinear interpolation when enlarging
+func resampleWeights(srcN int, n int) [][]contribution {
+	weights := make([][]contribution, n)
+	scale := float64(srcN) / float64(n)
+	for j := range weights {
+		if scale >= 1 {
+			lo := float64(j) * scale
+			hi := lo + scale
+			for i := int(lo); i < srcN && float64(i) < hi; i++ {
+				overlap := math.Min(hi, float64(i+1)) - math.Max(lo, float64(i))
+				if overlap > 0 {
+					weights[j] = append(weights[j], contribution{i, overlap / scale})
+				}
+			}
+			continue
+		}
+		x := math.Max((float64(j)+0.5)*scale-0.5, 0)
+		i := int(x)
+		if i+1 >= srcN {
+			weights[j] = []contribution{{srcN - 1, 1}}
+			continue
+		}
+		f := x - float64(i)
+		weights[j] = []contribution{{i, 1 - f}, {i + 1, f}}
+	}
+	return weights
+}
+
+func clamp8(v float64) uint8 {
+	switch {
+	case v <= 0:
+		return 0
+	case v >= 255:
+		return 255
+	}
+	return uint8(v + 0.5)
+}
+
+// resize returns src, whose origin is (0, 0), resized to width x height
+func resize(src *image.RGBA, width int, height int) *image.RGBA {
+	srcWidth, srcHeight := src.Bounds().Dx(), src.Bounds().Dy()
+	xWeights := resampleWeights(srcWidth, width)
+	yWeights := resampleWeights(srcHeight, height)
+
+	// resize horizontally, then vertically
+	tmp := make([]float64, width*srcHeight*4)
+	for y := 0; y < srcHeight; y++ {
+		row := src.Pix[y*src.Stride:]
+		for x, contributions := range xWeights {
+			t := tmp[(y*width+x)*4:]
+			for _, c := range contributions {
+				p := row[c.index*4:]
+				for k := 0; k < 4; k++ {
+					t[k] += float64(p[k]) * c.weight
+				}
+			}
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y, contributions := range yWeights {
+		for x := 0; x < width; x++ {
+			var v [4]float64
+			for _, c := range contributions {
+				t := tmp[(c.index*width+x)*4:]
+				for k := 0; k < 4; k++ {
+					v[k] += t[k] * c.weight
+				}
+			}
+			d := dst.Pix[y*dst.Stride+x*4:]
+			for k := 0; k < 4; k++ {
+				d[k] = clamp8(v[k])
+			}
+		}
+	}
+	return dst
+}
+
+// stripJPEG removes the metadata segments (EXIF, XMP, comments, etc.) from
+// the JPEG in data, keeping those needed to display it (JFIF, ICC profile
+// and Adobe)
+func stripJPEG(data []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return nil, errors.New("missing SOI marker")
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:2])
+	for i := 2; ; {
+		if i+4 > len(data) || data[i] != 0xff {
+			return nil, errors.New("invalid segment")
+		}
+		marker := data[i+1]
+		if marker == 0xff { // fill byte
+			i++
+			continue
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			return nil, errors.New("invalid segment length")
+		}
+		segment := data[i:end]
+		switch {
+		case marker == 0xda: // start of scan: the rest is the image
+			out.Write(data[i:])
+			return out.Bytes(), nil
+		case marker == 0xe0, marker == 0xee: // JFIF, Adobe
+		case marker == 0xe2 && bytes.HasPrefix(segment[4:], []byte("ICC_PROFILE\x00")):
+		case marker >= 0xe1 && marker <= 0xef, marker == 0xfe: // APPn, COM
+			segment = nil
+		}
+		out.Write(segment)
+		i = end
+	}
+}
+
+// stripPNG removes the metadata chunks (text, EXIF, time, etc.) from the PNG
+// in data
+func stripPNG(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, errors.New("missing PNG signature")
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(pngSignature)
+	for i := len(pngSignature); i < len(data); {
+		if i+12 > len(data) {
+			return nil, errors.New("invalid chunk")
+		}
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		end := i + 12 + length
+		if length < 0 || end > len(data) {
+			return nil, errors.New("invalid chunk length")
+		}
+		name := string(data[i+4 : i+8])
+		if name[0] >= 'A' && name[0] <= 'Z' || pngChunks[name] {
+			out.Write(data[i:end])
+		}
+		if name == "IEND" {
+			return out.Bytes(), nil
+		}
+		i = end
+	}
+	return nil, errors.New("missing IEND chunk")
+}
+
+// ImageMap is the season_image and disc_image fields of the .yaml files: the
+// images of the seasons' or discs' episodes, by season or disc number
+type ImageMap map[string]string
+
+// episodeArtwork holds the episodes' artwork, by their image column, or nil,
+// if it cannot be read
+var episodeArtwork = make(map[string]*Artwork)
+
+// readArtwork returns the artwork in filename, conformed, if image_conform is true
+func readArtwork(filename string) (*Artwork, error) {
+	if defaults.imageConform {
+		return conformImage(filename)
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return &Artwork{
+		Name:     path.Base(filename),
+		MimeType: "image/" + format,
+		Data:     data,
+		Width:    config.Width,
+		Height:   config.Height,
+	}, nil
+}
+
+// setTrackImage sets track's image to its season's, or else its disc's, image,
+// if the image column is empty, and reads it. Tracks without an image use
+// the podcast's
+func setTrackImage(track *Track) {
+	if track.Image == "" && track.Season != "" {
+		track.Image = defaults.SeasonImage[track.Season]
+	}
+	if track.Image == "" {
+		track.Image = defaults.DiscImage[track.DiscNumber]
+	}
+	if track.Image != "" && loadArtwork(track.Image) == nil {
+		track.Image = ""
+	}
+}
+
+// loadArtwork returns the artwork in filename, reading it the first time, or
+// nil, if it cannot be read
+func loadArtwork(filename string) *Artwork {
+	art, ok := episodeArtwork[filename]
+	if !ok {
+		var err error
+		art, err = readArtwork(filename)
+		if err != nil {
+			log.Warnf("Cannot read %q: %s", filename, err)
+		} else {
+			art.Name = episodeImageName(filename, art)
+		}
+		episodeArtwork[filename] = art
+	}
+	return art
+}
+
+// episodeImageName returns the name of the artwork in filename in output_dir:
+// its own name, unless the show's image, or another episode's image, is
+// saved under that name, in which case a hash of its contents is added to it
+func episodeImageName(filename string, art *Artwork) string {
+	taken := art.Name == showImageName() && path.Clean(filename) != path.Clean(defaults.Image)
+	if taken && defaults.artwork != nil && bytes.Equal(art.Data, defaults.artwork.Data) {
+		taken = false
+	}
+	for other, a := range episodeArtwork {
+		if a != nil && a.Name == art.Name && other != filename && !bytes.Equal(a.Data, art.Data) {
+			taken = true
+		}
+	}
+	if !taken {
+		return art.Name
+	}
+	// "cover.jpg" -> "cover-1a2b3c4d.jpg"
+	ext := path.Ext(art.Name)
+	sum := sha1.Sum(art.Data)
+	return fmt.Sprintf("%s-%x%s", strings.TrimSuffix(art.Name, ext), sum[:4], ext)
+}
+
+// trackArtwork returns track's artwork, or nil, if it uses the podcast's
+func trackArtwork(track *Track) *Artwork {
+	return episodeArtwork[track.Image]
+}
+
+// copyEpisodeImages saves the episodes', and their chapters', artwork in outputDir
+func copyEpisodeImages(tracks []*Track, outputDir string) {
+	// episodeImageName gave different images different names
+	saved := map[string]bool{showImageName(): true}
+	for _, track := range tracks {
+		if !track.IsValid() {
+			continue
+		}
+		images := []string{track.Image}
+		for _, c := range track.ChapterList {
+			images = append(images, c.Image)
+		}
+		for _, image := range images {
+			art := episodeArtwork[image]
+			if art == nil {
+				continue
+			}
+			if saved[art.Name] {
+				continue
+			}
+			saved[art.Name] = true
+			newPath := outputDir + art.Name
+			if dryRun {
+				planCopy(image, newPath)
+				continue
+			}
+			log.Infof("Saving %q to %q", image, newPath)
+			err := ioutil.WriteFile(newPath, art.Data, 0644)
+			if err != nil {
+				log.Fatalf("Cannot write %q: %s", newPath, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStripJPEG(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, img, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	exif := append([]byte{0xff, 0xe1, 0x00, 0x0a}, "Exif\x00\x00ab"...)
+	comment := append([]byte{0xff, 0xfe, 0x00, 0x07}, "hello"...)
+	in := append(append(append(append([]byte{}, data[:2]...), exif...), comment...), data[2:]...)
+
+	out, err := stripJPEG(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Errorf("stripJPEG() returned %d bytes, want the %d bytes without the EXIF and comment segments", len(out), len(data))
+	}
+}
+
+func TestResize(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for x := 0; x < 4; x++ {
+		for y := 0; y < 4; y++ {
+			src.Set(x, y, color.RGBA{uint8(x * 80), 0, 0, 255})
+		}
+	}
+	dst := resize(src, 2, 2)
+	// each pixel is the average of two columns
+	for x, want := range []uint8{40, 200} {
+		if got := dst.RGBAAt(x, 0).R; got != want {
+			t.Errorf("resize(): pixel (%d, 0) is %d, want %d", x, got, want)
+		}
+	}
+	dst = resize(src, 8, 8)
+	if got := dst.Bounds().Dx(); got != 8 {
+		t.Errorf("resize(): width is %d, want 8", got)
+	}
+}
+
+func TestEpisodeImageNames(t *testing.T) {
+	defer func(d *Default, a map[string]*Artwork) { defaults, episodeArtwork = d, a }(defaults, episodeArtwork)
+	defaults = &Default{Image: "show.png"}
+	episodeArtwork = make(map[string]*Artwork)
+
+	dir := t.TempDir()
+	write := func(name string, shade uint8) string {
+		img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+		img.Set(0, 0, color.RGBA{shade, 0, 0, 255})
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		filename := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return filename
+	}
+
+	tests := []struct {
+		filename string
+		want     string
+	}{
+		{write("season1/cover.png", 1), "cover.png"},
+		// the same name, and different contents
+		{write("season2/cover.png", 2), "cover-"},
+		// the same name, and the same contents
+		{write("season3/cover.png", 1), "cover.png"},
+		// the show's image's name
+		{write("episodes/show.png", 3), "show-"},
+		{write("episode.png", 4), "episode.png"},
+	}
+	names := make(map[string]string)
+	for _, tt := range tests {
+		art := loadArtwork(tt.filename)
+		if art == nil {
+			t.Fatalf("loadArtwork(%q) = nil", tt.filename)
+		}
+		if !strings.HasPrefix(art.Name, tt.want) || strings.HasSuffix(tt.want, "-") && len(art.Name) != len(tt.want)+len("12345678.png") {
+			t.Errorf("loadArtwork(%q).Name = %q, want %q", tt.filename, art.Name, tt.want)
+		}
+		if other, ok := names[art.Name]; ok && !bytes.Equal(loadArtwork(other).Data, art.Data) {
+			t.Errorf("loadArtwork(%q).Name = %q, which %q, a different image, has", tt.filename, art.Name, other)
+		}
+		names[art.Name] = tt.filename
+	}
+}
+
+func TestConformImage(t *testing.T) {
+	defer func(d *Default) { defaults = d }(defaults)
+	dir := t.TempDir()
+	red := color.RGBA{0xff, 0, 0, 0xff}
+	pad := color.RGBA{0, 0, 0xff, 0xff}
+
+	tests := []struct {
+		name   string
+		img    image.Image
+		fit    string
+		width  int // the converted image's, or 0, if it is used as is
+		mime   string
+		corner color.RGBA // the converted image's top left pixel
+	}{
+		{"rgb.jpg", uniform(image.NewRGBA(image.Rect(0, 0, 1400, 1400)), red), "crop", 0, "image/jpeg", red},
+		{"rgb.png", uniform(image.NewRGBA(image.Rect(0, 0, 1400, 1400)), red), "crop", 0, "image/png", red},
+		{"gray.jpg", image.NewGray(image.Rect(0, 0, 1400, 1400)), "crop", 1400, "image/jpeg", color.RGBA{0, 0, 0, 0xff}},
+		{"gray.png", image.NewGray16(image.Rect(0, 0, 1400, 1400)), "crop", 1400, "image/png", color.RGBA{0, 0, 0, 0xff}},
+		{"wide-crop.png", uniform(image.NewRGBA(image.Rect(0, 0, 1600, 1500)), red), "crop", 1500, "image/png", red},
+		{"wide-pad.png", uniform(image.NewRGBA(image.Rect(0, 0, 1600, 1500)), red), "pad", 1600, "image/png", pad},
+		{"small.png", uniform(image.NewRGBA(image.Rect(0, 0, 700, 700)), red), "crop", 1400, "image/png", red},
+		{"transparent.png", image.NewRGBA(image.Rect(0, 0, 700, 700)), "crop", 1400, "image/png", pad},
+		{"transparent-pad.png", image.NewNRGBA(image.Rect(0, 0, 700, 600)), "pad", 1400, "image/png", pad},
+		{"large.jpg", uniform(image.NewRGBA(image.Rect(0, 0, 3200, 3200)), red), "crop", 3000, "image/jpeg", red},
+	}
+	for _, tt := range tests {
+		if tt.width > imageWidthMax && testing.Short() {
+			continue
+		}
+		defaults = &Default{ImageFit: tt.fit, imagePadColor: pad, imageSizeMax: 1 << 20}
+		filename := filepath.Join(dir, tt.name)
+		var buf bytes.Buffer
+		var err error
+		if strings.HasSuffix(tt.name, ".png") {
+			err = png.Encode(&buf, tt.img)
+		} else {
+			err = jpeg.Encode(&buf, tt.img, nil)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(filename, buf.Bytes(), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		art, err := conformImage(filename)
+		if err != nil {
+			t.Errorf("conformImage(%q) = %v", tt.name, err)
+			continue
+		}
+		if art.MimeType != tt.mime {
+			t.Errorf("conformImage(%q).MimeType = %q, want %q", tt.name, art.MimeType, tt.mime)
+		}
+		if tt.width == 0 {
+			if art.Name != tt.name || !bytes.Equal(art.Data, buf.Bytes()) {
+				t.Errorf("conformImage(%q) converted it, want it as is", tt.name)
+			}
+			continue
+		}
+		img, _, err := image.Decode(bytes.NewReader(art.Data))
+		if err != nil {
+			t.Errorf("conformImage(%q): %v", tt.name, err)
+			continue
+		}
+		b := img.Bounds()
+		if b.Dx() != tt.width || b.Dy() != tt.width || art.Width != tt.width || art.Height != tt.width {
+			t.Errorf("conformImage(%q) is %dx%d (%dx%d), want %dx%d", tt.name, b.Dx(), b.Dy(), art.Width, art.Height, tt.width, tt.width)
+		}
+		if !rgbModel(img.ColorModel()) {
+			t.Errorf("conformImage(%q) is not RGB", tt.name)
+		}
+		r, g, bl, a := img.At(b.Min.X, b.Min.Y).RGBA()
+		got := color.RGBA{uint8(r >> 8), uint8(g >> 8), uint8(bl >> 8), uint8(a >> 8)}
+		if !near(got, tt.corner) {
+			t.Errorf("conformImage(%q): top left pixel is %v, want %v", tt.name, got, tt.corner)
+		}
+	}
+}
+
+// uniform fills img with c
+func uniform(img *image.RGBA, c color.RGBA) *image.RGBA {
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+	}
+	return img
+}
+
+// near returns true if the channels of a and b differ by JPEG noise at most
+func near(a color.RGBA, b color.RGBA) bool {
+	diff := func(x, y uint8) bool { return x-y < 8 || y-x < 8 }
+	return diff(a.R, b.R) && diff(a.G, b.G) && diff(a.B, b.B) && a.A == b.A
+}
+
+func TestEncodeArtwork(t *testing.T) {
+	defer func(d *Default) { defaults = d }(defaults)
+	// noise compresses badly, so the sizes depend on the quality
+	img := image.NewRGBA(image.Rect(0, 0, 1500, 1500))
+	rand.New(rand.NewSource(1)).Read(img.Pix)
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 0xff
+	}
+	size := func(img *image.RGBA, quality int) int64 {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			t.Fatal(err)
+		}
+		return int64(buf.Len())
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	pngSize := int64(buf.Len())
+	scaled := resize(img, imageWidthMin, imageWidthMin)
+
+	tests := []struct {
+		asPNG   bool
+		sizeMax int64
+		mime    string
+		width   int
+		fits    bool
+	}{
+		{true, pngSize, "image/png", 1500, true},
+		{true, pngSize - 1, "image/jpeg", 1500, true},
+		{false, size(img, jpegQualityMin), "image/jpeg", 1500, true},
+		{false, size(img, jpegQualityMin) - 1, "image/jpeg", imageWidthMin, size(scaled, jpegQualityMin) < size(img, jpegQualityMin)},
+		{false, 1000, "image/jpeg", imageWidthMin, false},
+	}
+	for _, tt := range tests {
+		defaults = &Default{imageSizeMax: tt.sizeMax}
+		art, err := encodeArtwork(img, "show", tt.asPNG)
+		if err != nil {
+			t.Fatalf("encodeArtwork(%t, %d) = %v", tt.asPNG, tt.sizeMax, err)
+		}
+		if art.MimeType != tt.mime || art.Width != tt.width {
+			t.Errorf("encodeArtwork(%t, %d) is a %dx%d %s, want a %dx%d %s",
+				tt.asPNG, tt.sizeMax, art.Width, art.Height, art.MimeType, tt.width, tt.width, tt.mime)
+		}
+		if fits := int64(len(art.Data)) <= tt.sizeMax; fits != tt.fits {
+			t.Errorf("encodeArtwork(%t, %d) is %d bytes, want it to fit: %t", tt.asPNG, tt.sizeMax, len(art.Data), tt.fits)
+		}
+	}
+}
+
+func TestStripPNG(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	chunk := func(name string, body string) []byte {
+		c := make([]byte, 8, 12+len(body))
+		binary.BigEndian.PutUint32(c, uint32(len(body)))
+		copy(c[4:], name)
+		c = append(c, body...)
+		crc := make([]byte, 4)
+		binary.BigEndian.PutUint32(crc, crc32.ChecksumIEEE(c[4:]))
+		return append(c, crc...)
+	}
+	// the IHDR chunk is 25 bytes, after the signature
+	ihdr := len(pngSignature) + 25
+	join := func(parts ...[]byte) []byte {
+		return bytes.Join(parts, nil)
+	}
+	gama := chunk("gAMA", "\x00\x00\xb1\x8f")
+	want := join(data[:ihdr], gama, data[ihdr:])
+	in := join(data[:ihdr], chunk("tEXt", "Comment\x00hello"), gama, chunk("tIME", "\x07\xe4\x01\x02\x03\x04\x05"), data[ihdr:])
+
+	tests := []struct {
+		in   []byte
+		want []byte
+		err  bool
+	}{
+		{data, data, false},
+		{in, want, false},
+		{data[1:], nil, true},
+		{data[:len(data)-12], nil, true},
+		{data[:len(data)-4], nil, true},
+	}
+	for i, tt := range tests {
+		got, err := stripPNG(tt.in)
+		if (err != nil) != tt.err {
+			t.Errorf("%d: stripPNG() = %v, want an error: %t", i, err, tt.err)
+			continue
+		}
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("%d: stripPNG() returned %d bytes, want %d", i, len(got), len(tt.want))
+		}
+	}
+	if _, err := png.Decode(bytes.NewReader(want)); err != nil {
+		t.Errorf("stripPNG() output cannot be decoded: %v", err)
+	}
+}
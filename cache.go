@@ -0,0 +1,231 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+
+	fpodcast "github.com/rasa/feedster/podcast"
+	"github.com/rasa/feedster/version"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	cacheFileName = ".feedster-cache.json"
+	cacheVersion  = 1
+)
+
+// CacheEntry records the state of a track after it was last processed
+type CacheEntry struct {
+	// ModTime and Size are the source file's, after tagging (if tag_in_place is true)
+	ModTime              int64                  `json:"mod_time"`
+	Size                 int64                  `json:"size"`
+	DurationMilliseconds int64                  `json:"duration_milliseconds"`
+	EnclosureType        fpodcast.EnclosureType `json:"enclosure_type"`
+	// Fingerprint is a hash of everything that was written to the tags
+	Fingerprint   string `json:"fingerprint"`
+	OutputName    string `json:"output_name"`
+	OutputSize    int64  `json:"output_size"`
+	OutputModTime int64  `json:"output_mod_time"`
+}
+
+// BuildCache holds the cache entries of the previous run, keyed by filename,
+// so unchanged tracks are not probed, tagged or copied again
+type BuildCache struct {
+	Version int                    `json:"version"`
+	Tracks  map[string]*CacheEntry `json:"tracks"`
+
+	filename string
+	used     map[string]bool
+}
+
+var cache *BuildCache
+
+func loadCache(filename string) (c *BuildCache) {
+	c = &BuildCache{
+		Version:  cacheVersion,
+		Tracks:   make(map[string]*CacheEntry),
+		filename: filename,
+		used:     make(map[string]bool),
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("Cannot read %q: %s", filename, err)
+		}
+		return c
+	}
+
+	var old BuildCache
+	err = json.Unmarshal(data, &old)
+	if err != nil {
+		log.Warnf("Cannot process %q: %s", filename, err)
+		return c
+	}
+	if old.Version != cacheVersion {
+		log.Infof("Ignoring %q: version %d != %d", filename, old.Version, cacheVersion)
+		return c
+	}
+	if old.Tracks != nil {
+		c.Tracks = old.Tracks
+	}
+	log.Debugf("Read %d cache entries from %q", len(c.Tracks), filename)
+	return c
+}
+
+// Save writes the entries for the tracks seen in this run to the cache file
+func (c *BuildCache) Save() {
+	if c == nil || c.filename == "" {
+		return
+	}
+	for k := range c.Tracks {
+		if !c.used[k] {
+			delete(c.Tracks, k)
+		}
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		log.Fatalf("Cannot process %q: %s", c.filename, err)
+	}
+	log.Debugf("Saving %d cache entries to %q", len(c.Tracks), c.filename)
+	err = ioutil.WriteFile(c.filename, data, 0644)
+	if err != nil {
+		log.Warnf("Cannot write %q: %s", c.filename, err)
+	}
+}
+
+// Lookup returns the cache entry for the track if its source file is unchanged
+func (c *BuildCache) Lookup(track *Track) *CacheEntry {
+	if c == nil {
+		return nil
+	}
+	entry, ok := c.Tracks[track.Filename]
+	if !ok {
+		return nil
+	}
+	c.used[track.Filename] = true
+	if entry.ModTime != track.OriginalModTime || entry.Size != track.OriginalFileSize {
+		log.Debugf("%q has changed since the last run", track.Filename)
+		return nil
+	}
+	return entry
+}
+
+// Current returns the cache entry for the track if it was already tagged
+// (and copied) with the same fingerprint, and the output file is unchanged
+func (c *BuildCache) Current(track *Track, fingerprint string) *CacheEntry {
+	entry := c.Lookup(track)
+	if entry == nil || entry.Fingerprint != fingerprint {
+		return nil
+	}
+	if entry.OutputName == "" {
+		// tag_in_place: the tagged source file itself is the output
+		return entry
+	}
+	fi, err := os.Stat(defaults.OutputDir + entry.OutputName)
+	if err != nil {
+		return nil
+	}
+	if fi.Size() != entry.OutputSize || fi.ModTime().UnixNano() != entry.OutputModTime {
+		log.Debugf("%q has changed since the last run", defaults.OutputDir+entry.OutputName)
+		return nil
+	}
+	return entry
+}
+
+// Update records the state of the track after it was tagged (and copied)
+func (c *BuildCache) Update(track *Track, fingerprint string) {
+	if c == nil {
+		return
+	}
+	entry := &CacheEntry{
+		DurationMilliseconds: track.DurationMilliseconds,
+		EnclosureType:        track.EnclosureType,
+		Fingerprint:          fingerprint,
+		OutputName:           track.OutputName,
+	}
+
+	fi, err := os.Stat(track.Filename)
+	if err != nil {
+		log.Warnf("Cannot open %q: %s", track.Filename, err)
+		return
+	}
+	entry.ModTime = fi.ModTime().UnixNano()
+	entry.Size = fi.Size()
+
+	if track.OutputName != "" {
+		fi, err = os.Stat(defaults.OutputDir + track.OutputName)
+		if err != nil {
+			log.Warnf("Cannot open %q: %s", defaults.OutputDir+track.OutputName, err)
+			return
+		}
+		entry.OutputSize = fi.Size()
+		entry.OutputModTime = fi.ModTime().UnixNano()
+	}
+
+	c.Tracks[track.Filename] = entry
+	c.used[track.Filename] = true
+}
+
+// tagFingerprint returns a hash of all the values setTags and setMP4Tags use
+func tagFingerprint(track *Track, tracks []*Track) string {
+	fields := track.Fields()
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha1.New()
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s=%s\n", k, fields[k])
+	}
+	fmt.Fprintf(h, "total_discs=%t,%d\n", defaults.totalDiscs, totalDiscs(tracks))
+	fmt.Fprintf(h, "total_tracks=%t,%d\n", defaults.totalTracks, totalTracks(tracks, track.DiscNumber))
+	fmt.Fprintf(h, "encoded_by=%s\n", defaults.EncodedBy)
+	fmt.Fprintf(h, "language=%s\n", defaults.Language)
+	fmt.Fprintf(h, "rename_mask=%s\n", defaults.RenameMask)
+	fmt.Fprintf(h, "tag_in_place=%t\n", defaults.tagInPlace)
+	fmt.Fprintf(h, "mod_time=%d\n", track.ModTime)
+	fmt.Fprintf(h, "timezone=%s\n", defaults.Timezone)
+	fmt.Fprintf(h, "original_filename=%s\n", track.OriginalFilename)
+	fmt.Fprintf(h, "original_file_size=%d\n", track.OriginalFileSize)
+	fmt.Fprintf(h, "duration=%d\n", track.DurationMilliseconds)
+	fmt.Fprintf(h, "version=%s\n", version.VERSION)
+
+	if defaults.Image != "" {
+		fi, err := os.Stat(defaults.Image)
+		if err == nil {
+			fmt.Fprintf(h, "image=%s,%d,%s\n", defaults.Image, fi.Size(), strconv.FormatInt(fi.ModTime().UnixNano(), 10))
+		}
+	}
+	art := trackArtwork(track)
+	if art == nil {
+		art = defaults.artwork
+	}
+	if art != nil {
+		fmt.Fprintf(h, "artwork=%x\n", sha1.Sum(art.Data))
+	}
+	for _, c := range track.ChapterList {
+		fmt.Fprintf(h, "chapter=%d,%s,%s\n", c.Start, c.Title, c.URL)
+		if art := episodeArtwork[c.Image]; art != nil {
+			fmt.Fprintf(h, "chapter_artwork=%x\n", sha1.Sum(art.Data))
+		}
+	}
+	if text := transcriptText(track); text != "" {
+		fmt.Fprintf(h, "transcript=%x\n", sha1.Sum([]byte(text)))
+		if defaults.transcriptSYLT {
+			fmt.Fprintf(h, "transcript_sylt=%v\n", transcriptCues(track))
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
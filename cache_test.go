@@ -0,0 +1,144 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBuildCache(t *testing.T) {
+	defer func(d *Default) { defaults = d }(defaults)
+	dir := t.TempDir()
+	defaults = &Default{OutputDir: dir + "/"}
+
+	src := filepath.Join(dir, "lesson01.mp3")
+	out := "Lesson 01.mp3"
+	write := func(filename, data string, modTime time.Time) {
+		err := ioutil.WriteFile(filename, []byte(data), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.Chtimes(filename, modTime, modTime)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	then := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	write(src, "source", then)
+	write(defaults.OutputDir+out, "output", then)
+
+	newTrack := func() *Track {
+		fi, err := os.Stat(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &Track{
+			Filename:         src,
+			OutputName:       out,
+			OriginalModTime:  fi.ModTime().UnixNano(),
+			OriginalFileSize: fi.Size(),
+		}
+	}
+
+	filename := filepath.Join(dir, cacheFileName)
+	c := loadCache(filename)
+	track := newTrack()
+	if c.Lookup(track) != nil {
+		t.Fatal("Lookup() of an empty cache != nil")
+	}
+	c.Update(track, "a")
+	c.Save()
+
+	tests := []struct {
+		name   string
+		change func()
+		lookup bool
+		fp     string
+		want   bool
+	}{
+		{"unchanged", func() {}, true, "a", true},
+		{"fingerprint", func() {}, true, "b", false},
+		{"output mtime", func() { write(defaults.OutputDir+out, "output", then.Add(time.Second)) }, true, "a", false},
+		{"output size", func() { write(defaults.OutputDir+out, "output2", then) }, true, "a", false},
+		{"output removed", func() { os.Remove(defaults.OutputDir + out) }, true, "a", false},
+		{"source mtime", func() { write(src, "source", then.Add(time.Second)) }, false, "a", false},
+		{"source size", func() { write(src, "source2", then) }, false, "a", false},
+	}
+	for _, tt := range tests {
+		write(src, "source", then)
+		write(defaults.OutputDir+out, "output", then)
+		tt.change()
+
+		c := loadCache(filename)
+		track := newTrack()
+		if got := c.Lookup(track) != nil; got != tt.lookup {
+			t.Errorf("%s: Lookup() != nil = %t, want %t", tt.name, got, tt.lookup)
+		}
+		if got := c.Current(track, tt.fp) != nil; got != tt.want {
+			t.Errorf("%s: Current() != nil = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+
+	// entries for tracks that were not looked up are dropped on save
+	c = loadCache(filename)
+	c.Save()
+	c = loadCache(filename)
+	if len(c.Tracks) != 0 {
+		t.Errorf("Save() kept %d unused entries, want 0", len(c.Tracks))
+	}
+}
+
+func TestTagFingerprint(t *testing.T) {
+	defer func(d *Default) { defaults = d }(defaults)
+	defer func(a map[string]*Artwork) { episodeArtwork = a }(episodeArtwork)
+	defaults = &Default{}
+	episodeArtwork = map[string]*Artwork{
+		"a.jpg": {Name: "a.jpg", Data: []byte("a")},
+		"b.jpg": {Name: "b.jpg", Data: []byte("b")},
+	}
+
+	newTrack := func() *Track {
+		return &Track{
+			Filename:             "lesson01.mp3",
+			Title:                "Lesson 01",
+			Image:                "a.jpg",
+			ModTime:              1,
+			OriginalFileSize:     2,
+			DurationMilliseconds: 3000,
+			ChapterList:          []Chapter{{Start: 0, Title: "Intro", Image: "a.jpg"}},
+		}
+	}
+	fingerprint := func(track *Track) string {
+		return tagFingerprint(track, []*Track{track})
+	}
+	base := fingerprint(newTrack())
+
+	tests := []struct {
+		name   string
+		change func(*Track)
+		same   bool
+	}{
+		{"unchanged", func(*Track) {}, true},
+		{"title", func(t *Track) { t.Title = "Lesson 1" }, false},
+		{"mtime", func(t *Track) { t.ModTime = 2 }, false},
+		{"size", func(t *Track) { t.OriginalFileSize = 3 }, false},
+		{"duration", func(t *Track) { t.DurationMilliseconds = 4000 }, false},
+		{"artwork", func(t *Track) { t.Image = "b.jpg" }, false},
+		{"artwork data", func(*Track) { episodeArtwork["a.jpg"].Data = []byte("c") }, false},
+		{"chapter start", func(t *Track) { t.ChapterList[0].Start = 1000 }, false},
+		{"chapter title", func(t *Track) { t.ChapterList[0].Title = "Start" }, false},
+		{"chapter url", func(t *Track) { t.ChapterList[0].URL = "https://example.com/" }, false},
+		{"chapter artwork", func(t *Track) { t.ChapterList[0].Image = "b.jpg" }, false},
+		{"chapters removed", func(t *Track) { t.ChapterList = nil }, false},
+	}
+	for _, tt := range tests {
+		episodeArtwork["a.jpg"].Data = []byte("a")
+		track := newTrack()
+		tt.change(track)
+		if got := fingerprint(track) == base; got != tt.same {
+			t.Errorf("%s: tagFingerprint() unchanged = %t, want %t", tt.name, got, tt.same)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	fpodcast "github.com/rasa/feedster/podcast"
+	log "github.com/sirupsen/logrus"
+)
+
+// Category is an entry in the category list of the .yaml files
+type Category struct {
+	Name          string   `yaml:"name"`
+	Subcategories []string `yaml:"subcategories,omitempty"`
+}
+
+// CategoryList is the category field of the .yaml files. It is a list of
+// categories, each a name, or a name and subcategories, or, as in earlier
+// versions, a single "Category,Subcategory" string
+type CategoryList []Category
+
+// UnmarshalYAML accepts a "Category,Subcategory" string, or a list
+func (l *CategoryList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err == nil {
+		*l = parseCategory(s)
+		return nil
+	}
+	var list []Category
+	if err := unmarshal(&list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+// UnmarshalYAML accepts a category name, or a name and subcategories
+func (c *Category) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err == nil {
+		c.Name = s
+		return nil
+	}
+	type category Category // without the UnmarshalYAML method
+	return unmarshal((*category)(c))
+}
+
+// parseCategory parses a "Category,Subcategory,..." string
+func parseCategory(s string) (l CategoryList) {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	names := strings.Split(s, ",")
+	c := Category{Name: strings.TrimSpace(names[0])}
+	for _, name := range names[1:] {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			c.Subcategories = append(c.Subcategories, name)
+		}
+	}
+	return CategoryList{c}
+}
+
+// categoryError returns the error for an invalid category or subcategory,
+// with a suggestion, if there is a close match, or nil if it is valid
+func categoryError(category string, subcategory string) error {
+	if fpodcast.ValidCategory(category, subcategory) {
+		return nil
+	}
+	suggestion := ""
+	if s := fpodcast.SuggestCategory(category, subcategory); s != "" {
+		suggestion = fmt.Sprintf(", did you mean %q?", s)
+	}
+	if subcategory == "" {
+		return fmt.Errorf("%q is not an Apple Podcasts category%s", category, suggestion)
+	}
+	return fmt.Errorf("%q is not a subcategory of %q%s", subcategory, category, suggestion)
+}
+
+// ICategories returns the categories as itunes:category elements
+func (l CategoryList) ICategories() (rv []*fpodcast.ICategory) {
+	for _, c := range l {
+		if c.Name == "" {
+			continue
+		}
+		icat := &fpodcast.ICategory{Text: c.Name}
+		for _, sc := range c.Subcategories {
+			icat.ICategories = append(icat.ICategories, &fpodcast.ICategory{Text: sc})
+		}
+		rv = append(rv, icat)
+	}
+	return rv
+}
+
+// addCategories validates the categories, and adds them to p
+func addCategories(p *fpodcast.Podcast, categories []*fpodcast.ICategory) {
+	for _, c := range categories {
+		var subCategories []string
+		err := categoryError(c.Text, "")
+		if err != nil {
+			log.Warnf("Category: %s", err)
+		}
+		for _, sc := range c.ICategories {
+			if err == nil {
+				if err := categoryError(c.Text, sc.Text); err != nil {
+					log.Warnf("Category: %s", err)
+				}
+			}
+			subCategories = append(subCategories, sc.Text)
+		}
+		p.AddCategory(c.Text, subCategories)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestCategoryList(t *testing.T) {
+	tests := []struct {
+		in   string
+		want CategoryList
+	}{
+		{"category: Education,Courses", CategoryList{{Name: "Education", Subcategories: []string{"Courses"}}}},
+		{"category: [Comedy, {name: Arts, subcategories: [Books, Food]}]", CategoryList{
+			{Name: "Comedy"},
+			{Name: "Arts", Subcategories: []string{"Books", "Food"}},
+		}},
+	}
+	for _, tt := range tests {
+		var got struct {
+			Category CategoryList `yaml:"category"`
+		}
+		err := yaml.Unmarshal([]byte(tt.in), &got)
+		if err != nil {
+			t.Errorf("%q: %s", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got.Category, tt.want) {
+			t.Errorf("%q: got %+v, want %+v", tt.in, got.Category, tt.want)
+		}
+	}
+
+	err := categoryError("Arts", "Bokks")
+	if err == nil || err.Error() != `"Bokks" is not a subcategory of "Arts", did you mean "Books"?` {
+		t.Errorf("categoryError() = %v", err)
+	}
+	if err := categoryError("TV & Film", "Film Reviews"); err != nil {
+		t.Errorf("categoryError() = %v, want nil", err)
+	}
+}
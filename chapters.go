@@ -0,0 +1,355 @@
+package main
+
+// chapters: ID3 CHAP and CTOC frames, and Podcasting 2.0 JSON chapters files
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bogem/id3v2"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	chaptersFileExt  = ".chapters.txt"
+	chaptersJSONExt  = ".chapters.json"
+	chaptersMax      = 255 // CTOC's entry count is a byte
+	chaptersVersion  = "1.2.0"
+	id3HeaderSize    = 10
+	id3FooterFlag    = 0x10
+	ctocTopLevel     = 0x02
+	ctocOrdered      = 0x01
+	chapUnusedOffset = 0xffffffff
+)
+
+// Chapter is a chapter of a track
+type Chapter struct {
+	Start int64 // milliseconds
+	Title string
+	URL   string
+	Image string
+}
+
+// hh:mm:ss.mmm, mm:ss or ss, then the title
+var chapterRegex = regexp.MustCompile(`^(\d+(?::\d{1,2}){0,2}(?:\.\d{1,3})?)(?:\s+(.*))?$`)
+
+// parseChapterTime parses hh:mm:ss.mmm, mm:ss, or ss, into milliseconds
+func parseChapterTime(s string) int64 {
+	var ms int64
+	if i := strings.Index(s, "."); i >= 0 {
+		fraction := (s[i+1:] + "00")[:3]
+		ms, _ = strconv.ParseInt(fraction, 10, 64)
+		s = s[:i]
+	}
+	var seconds int64
+	for _, part := range strings.Split(s, ":") {
+		n, _ := strconv.ParseInt(part, 10, 64)
+		seconds = seconds*60 + n
+	}
+	return seconds*1000 + ms
+}
+
+// chapterLines splits s into lines, or at semicolons
+func chapterLines(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool { return r == '\n' || r == ';' })
+}
+
+// parseChapters parses chapters, one per line (or separated by semicolons),
+// as "hh:mm:ss Title | URL | image". Blank lines, and those starting with
+// #, are ignored
+func parseChapters(s string) (chapters []Chapter, err error) {
+	for _, line := range chapterLines(s) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		b := chapterRegex.FindStringSubmatch(line)
+		if b == nil {
+			return nil, fmt.Errorf("%q is not \"hh:mm:ss Title\"", line)
+		}
+		fields := strings.Split(b[2], "|")
+		for len(fields) < 3 {
+			fields = append(fields, "")
+		}
+		chapters = append(chapters, Chapter{
+			Start: parseChapterTime(b[1]),
+			Title: strings.TrimSpace(fields[0]),
+			URL:   strings.TrimSpace(fields[1]),
+			Image: strings.TrimSpace(fields[2]),
+		})
+	}
+	sort.SliceStable(chapters, func(i, j int) bool { return chapters[i].Start < chapters[j].Start })
+	return chapters, nil
+}
+
+// setTrackChapters reads the track's chapters from the chapters column, if it
+// is a .txt file, or chapters, or else from <filename>.chapters.txt, if it
+// exists. A chapters column with a URL, or .json file, is left as is
+func setTrackChapters(track *Track) {
+	track.ChapterList = nil
+	source := track.Chapters
+	text := track.Chapters
+	if track.Chapters == "" || strings.EqualFold(filepath.Ext(track.Chapters), ".txt") {
+		if source == "" {
+			source = track.Filename + chaptersFileExt
+			_, err := os.Stat(source)
+			if err != nil && track.Source != "" {
+				source = track.Source + chaptersFileExt
+				_, err = os.Stat(source)
+			}
+			if err != nil {
+				return
+			}
+		}
+		data, err := ioutil.ReadFile(source)
+		if err != nil {
+			log.Warnf("Cannot read %q: %s", source, err)
+			return
+		}
+		text = string(data)
+	} else if lines := chapterLines(text); len(lines) == 0 || !chapterRegex.MatchString(strings.TrimSpace(lines[0])) {
+		// the URL of a chapters file
+		return
+	}
+
+	chapters, err := parseChapters(text)
+	if err != nil {
+		log.Warnf("Cannot parse the chapters of %q: %s", track.Filename, err)
+		return
+	}
+	if len(chapters) > chaptersMax {
+		log.Warnf("%q has %d chapters, only the first %d are used", track.Filename, len(chapters), chaptersMax)
+		chapters = chapters[:chaptersMax]
+	}
+	for i, c := range chapters {
+		if track.DurationMilliseconds > 0 && c.Start >= track.DurationMilliseconds {
+			log.Warnf("%q: chapter %q starts after the end of the track", track.Filename, c.Title)
+		}
+		if c.Image != "" && loadArtwork(c.Image) == nil {
+			chapters[i].Image = ""
+		}
+	}
+	log.Debugf("Read %d chapters for %q", len(chapters), track.Filename)
+	track.ChapterList = chapters
+}
+
+// chapterEnd returns the end of the i'th chapter: the start of the next one,
+// or the end of the track
+func chapterEnd(track *Track, i int) int64 {
+	if i+1 < len(track.ChapterList) {
+		return track.ChapterList[i+1].Start
+	}
+	if track.DurationMilliseconds > track.ChapterList[i].Start {
+		return track.DurationMilliseconds
+	}
+	return track.ChapterList[i].Start
+}
+
+// chaptersName returns the name of the track's JSON chapters file in output_dir
+func chaptersName(track *Track) string {
+	return basename(path.Base(track.OutputName)) + chaptersJSONExt
+}
+
+// id3Frame returns the frame id, with body, as an ID3v2.version frame
+func id3Frame(id string, body []byte, version byte) []byte {
+	frame := make([]byte, id3HeaderSize, id3HeaderSize+len(body))
+	copy(frame, id)
+	size := uint32(len(body))
+	if version == 4 {
+		size = synchsafe(size)
+	}
+	binary.BigEndian.PutUint32(frame[4:], size)
+	return append(frame, body...)
+}
+
+// synchsafe returns n with every byte's high bit clear, as ID3v2.4 sizes are
+func synchsafe(n uint32) uint32 {
+	return n&0x7f | (n&0x3f80)<<1 | (n&0x1fc000)<<2 | (n&0xfe00000)<<3
+}
+
+// unsynchsafe is the reverse of synchsafe
+func unsynchsafe(n uint32) uint32 {
+	return n&0x7f | (n&0x7f00)>>1 | (n&0x7f0000)>>2 | (n&0x7f000000)>>3
+}
+
+// framerBytes returns the body of f
+func framerBytes(f id3v2.Framer) []byte {
+	var buf bytes.Buffer
+	_, _ = f.WriteTo(&buf)
+	return buf.Bytes()
+}
+
+// chapterFrames returns the track's chapters as a CTOC frame, and a CHAP
+// frame for each chapter, each with its title, and, if set, URL and image.
+//
+// See http://id3.org/id3v2-chapters-1.0
+func chapterFrames(track *Track, version byte) []byte {
+	encoding := id3v2.EncodingUTF16
+	if version == 4 {
+		encoding = id3v2.EncodingUTF8
+	}
+
+	var frames []byte
+	var ids []string
+	for i, c := range track.ChapterList {
+		id := fmt.Sprintf("chp%d", i)
+		ids = append(ids, id)
+
+		var body []byte
+		body = append(body, id...)
+		body = append(body, 0)
+		offsets := make([]byte, 16)
+		binary.BigEndian.PutUint32(offsets[0:], uint32(c.Start))
+		binary.BigEndian.PutUint32(offsets[4:], uint32(chapterEnd(track, i)))
+		binary.BigEndian.PutUint32(offsets[8:], chapUnusedOffset)
+		binary.BigEndian.PutUint32(offsets[12:], chapUnusedOffset)
+		body = append(body, offsets...)
+		if c.Title != "" {
+			body = append(body, id3Frame("TIT2", framerBytes(id3v2.TextFrame{Encoding: encoding, Text: c.Title}), version)...)
+		}
+		if c.URL != "" {
+			// WXXX: ISO-8859-1 encoding, an empty description, and the URL
+			wxxx := append([]byte{id3v2.EncodingISO.Key, 0}, c.URL...)
+			body = append(body, id3Frame("WXXX", wxxx, version)...)
+		}
+		if art := episodeArtwork[c.Image]; art != nil {
+			pic := id3v2.PictureFrame{
+				Encoding:    encoding,
+				MimeType:    art.MimeType,
+				PictureType: id3v2.PTOther,
+				Description: c.Title,
+				Picture:     art.Data,
+			}
+			body = append(body, id3Frame("APIC", framerBytes(pic), version)...)
+		}
+		frames = append(frames, id3Frame("CHAP", body, version)...)
+	}
+
+	toc := []byte("toc\x00")
+	toc = append(toc, ctocTopLevel|ctocOrdered, byte(len(ids)))
+	for _, id := range ids {
+		toc = append(toc, id...)
+		toc = append(toc, 0)
+	}
+	return append(id3Frame("CTOC", toc, version), frames...)
+}
+
+// saveTag saves tag to filename, adding the track's chapters, and closes it.
+// id3v2 keeps only one frame of each ID (other than APIC, COMM, TXXX and
+// USLT), so the CHAP frames are added to the tag it writes
+func saveTag(tag *id3v2.Tag, filename string, track *Track) error {
+	defer tag.Close()
+	if len(track.ChapterList) == 0 {
+		return tag.Save()
+	}
+
+	var buf bytes.Buffer
+	_, err := tag.WriteTo(&buf)
+	if err != nil {
+		return err
+	}
+	header := buf.Bytes()
+	if len(header) < id3HeaderSize {
+		header = []byte{'I', 'D', '3', tag.Version(), 0, 0, 0, 0, 0, 0}
+	}
+	frames := chapterFrames(track, tag.Version())
+	size := uint32(len(header) - id3HeaderSize + len(frames))
+	binary.BigEndian.PutUint32(header[6:], synchsafe(size))
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	// skip the existing tag
+	audio := data
+	if len(data) >= id3HeaderSize && string(data[:3]) == "ID3" {
+		n := id3HeaderSize + int(unsynchsafe(binary.BigEndian.Uint32(data[6:])))
+		if data[5]&id3FooterFlag != 0 {
+			n += id3HeaderSize
+		}
+		if n > len(data) {
+			n = len(data)
+		}
+		audio = data[n:]
+	}
+
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	// Windows cannot replace a file that is open
+	tag.Close()
+	tmp := filename + ".tmp"
+	err = ioutil.WriteFile(tmp, append(append(header, frames...), audio...), fi.Mode())
+	if err == nil {
+		err = os.Rename(tmp, filename)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// jsonChapters is a Podcasting 2.0 JSON chapters file.
+//
+// See https://github.com/Podcastindex-org/podcast-namespace/blob/main/chapters/jsonChapters.md
+type jsonChapters struct {
+	Version  string        `json:"version"`
+	Chapters []jsonChapter `json:"chapters"`
+}
+
+type jsonChapter struct {
+	StartTime float64 `json:"startTime"`
+	EndTime   float64 `json:"endTime,omitempty"`
+	Title     string  `json:"title,omitempty"`
+	Img       string  `json:"img,omitempty"`
+	URL       string  `json:"url,omitempty"`
+}
+
+// writeChapters saves the JSON chapters files of the tracks in outputDir
+func writeChapters(tracks []*Track, outputDir string) {
+	for _, track := range tracks {
+		if !track.IsValid() || len(track.ChapterList) == 0 {
+			continue
+		}
+		chapters := jsonChapters{Version: chaptersVersion}
+		for i, c := range track.ChapterList {
+			jc := jsonChapter{
+				StartTime: float64(c.Start) / 1000,
+				EndTime:   float64(chapterEnd(track, i)) / 1000,
+				Title:     c.Title,
+				URL:       c.URL,
+			}
+			if art := episodeArtwork[c.Image]; art != nil {
+				jc.Img = defaults.BaseURL + art.Name
+			}
+			chapters.Chapters = append(chapters.Chapters, jc)
+		}
+		data, err := json.MarshalIndent(chapters, "", "  ")
+		if err != nil {
+			log.Fatalf("Cannot encode the chapters of %q: %s", track.Filename, err)
+		}
+		data = append(data, '\n')
+
+		filename := outputDir + chaptersName(track)
+		if dryRun {
+			planFeed(filename, data)
+			continue
+		}
+		log.Infof("Creating %q", filename)
+		err = ioutil.WriteFile(filename, data, 0644)
+		if err != nil {
+			log.Fatalf("Cannot write %q: %s", filename, err)
+		}
+	}
+}
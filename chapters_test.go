@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/bogem/id3v2"
+	fpodcast "github.com/rasa/feedster/podcast"
+)
+
+func TestParseChapters(t *testing.T) {
+	got, err := parseChapters("# comment\n1:02:03.5 Three | https://example.com/3\n\n00:10 Two; 0 One | | one.jpg\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Chapter{
+		{Start: 0, Title: "One", Image: "one.jpg"},
+		{Start: 10000, Title: "Two"},
+		{Start: 3723500, Title: "Three", URL: "https://example.com/3"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseChapters() = %+v, want %+v", got, want)
+	}
+
+	_, err = parseChapters("Intro 00:00")
+	if err == nil {
+		t.Error("parseChapters(\"Intro 00:00\") succeeded, want an error")
+	}
+}
+
+func TestSynchsafe(t *testing.T) {
+	for _, n := range []uint32{0, 0x7f, 0x80, 186501, 0x0fffffff} {
+		s := synchsafe(n)
+		if s&0x80808080 != 0 || unsynchsafe(s) != n {
+			t.Errorf("synchsafe(%d) = %#x", n, s)
+		}
+	}
+}
+
+func TestSaveTag(t *testing.T) {
+	defer func(a map[string]*Artwork) { episodeArtwork = a }(episodeArtwork)
+	episodeArtwork = make(map[string]*Artwork)
+	audio := bytes.Repeat([]byte{0xff, 0xfb, 0x90, 0x64}, 64)
+
+	tests := []struct {
+		name     string
+		existing []byte // the tag already in the file
+		chapters []Chapter
+	}{
+		{"untagged", nil, []Chapter{{Start: 0, Title: "Intro"}, {Start: 1000, Title: "Two", URL: "https://example.com/"}}},
+		// a 20 byte ID3v2.4 tag, with padding
+		{"tagged", append([]byte("ID3\x04\x00\x00\x00\x00\x00\x14"), make([]byte, 20)...), []Chapter{{Start: 0, Title: "One"}}},
+		{"no chapters", nil, nil},
+	}
+	for _, tt := range tests {
+		filename := filepath.Join(t.TempDir(), "lesson01.mp3")
+		err := ioutil.WriteFile(filename, append(append([]byte{}, tt.existing...), audio...), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tag, err := id3v2.Open(filename, id3v2.Options{Parse: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tag.SetTitle("Lesson 01")
+		track := &Track{Filename: filename, DurationMilliseconds: 2000, ChapterList: tt.chapters}
+
+		err = saveTag(tag, filename, track)
+		if err != nil {
+			t.Fatalf("%s: saveTag() = %v", tt.name, err)
+		}
+		// no temporary file is left behind
+		if _, err := os.Stat(filename + ".tmp"); !os.IsNotExist(err) {
+			t.Errorf("%s: saveTag() left %q", tt.name, filename+".tmp")
+		}
+
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) < id3HeaderSize || string(data[:3]) != "ID3" {
+			t.Fatalf("%s: saveTag() wrote no ID3 header", tt.name)
+		}
+		size := id3HeaderSize + int(unsynchsafe(binary.BigEndian.Uint32(data[6:])))
+		if size > len(data) || !bytes.Equal(data[size:], audio) {
+			t.Errorf("%s: the audio does not start after the %d byte tag", tt.name, size)
+			continue
+		}
+		if got := bytes.Count(data[:size], []byte("CHAP")); got != len(tt.chapters) {
+			t.Errorf("%s: saveTag() wrote %d CHAP frames, want %d", tt.name, got, len(tt.chapters))
+		}
+		if len(tt.chapters) > 0 && !bytes.HasSuffix(data[:size], chapterFrames(track, data[3])) {
+			t.Errorf("%s: saveTag() did not end the tag with the chapter frames", tt.name)
+		}
+
+		tag, err = id3v2.Open(filename, id3v2.Options{Parse: true})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := tag.Title(); got != "Lesson 01" {
+			t.Errorf("%s: the title is %q, want %q", tt.name, got, "Lesson 01")
+		}
+		tag.Close()
+	}
+}
+
+func TestAddPodcastTagsChapters(t *testing.T) {
+	defer func(d *Default) { defaults = d }(defaults)
+	defaults = &Default{BaseURL: "https://example.com/show/"}
+
+	tests := []struct {
+		chapters string
+		list     []Chapter
+		want     string
+	}{
+		{"", nil, ""},
+		{"lesson01.txt", []Chapter{{Title: "Intro"}}, "https://example.com/show/Lesson 01.chapters.json"},
+		// a .txt file that is missing, or chapters that cannot be parsed
+		{"lesson01.txt", nil, ""},
+		{"0:00 Intro; 1:2x:00 Two", nil, ""},
+		{"lesson01.json", nil, "https://example.com/show/lesson01.json"},
+		{"https://cdn.example.com/chapters.json", nil, "https://cdn.example.com/chapters.json"},
+	}
+	for _, tt := range tests {
+		item := &fpodcast.Item{}
+		track := &Track{OutputName: "Lesson 01.mp3", Chapters: tt.chapters, ChapterList: tt.list}
+		addPodcastTags(item, track)
+		got := ""
+		if item.PChapters != nil {
+			got = item.PChapters.URL
+		}
+		if got != tt.want {
+			t.Errorf("addPodcastTags(%q) chapters = %q, want %q", tt.chapters, got, tt.want)
+		}
+	}
+}
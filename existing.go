@@ -0,0 +1,101 @@
+package main
+
+// prefer_existing_tags: use the tracks' existing tags for the tracks file's empty cells
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/bogem/id3v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// existingFrames are the ID3 frames (by description), and MP4 items, read
+// for each tracks file column
+var existingFrames = []struct {
+	field string
+	id3   string
+	mp4   string
+}{
+	{"title", "Title", mp4Title},
+	{"artist", "Artist", mp4Artist},
+	{"album_title", "Album/Movie/Show title", mp4Album},
+	{"album_artist", "Band/Orchestra/Accompaniment", mp4AlbumArtist},
+	{"composer", "Composer", mp4Composer},
+	{"copyright", "Copyright message", mp4Copyright},
+	{"description", "Subtitle/Description refinement", mp4Description},
+	{"disc_number", "Part of a set", mp4Disc},
+	{"genre", "Content type", mp4Genre},
+	{"track", "Track number/Position in set", mp4Track},
+	{"year", "Year", mp4Year},
+}
+
+var yearRegex = regexp.MustCompile(`^[12]\d{3}$`)
+
+// "1234 bytes": an MP4 item that is not text
+var mp4BinaryRegex = regexp.MustCompile(`^\d+ bytes$`)
+
+// existingTags returns the track's existing tags, keyed by tracks file column
+func existingTags(filename string) (map[string]string, error) {
+	rv := make(map[string]string)
+	if isMP4(getEnclosureType(filename)) {
+		f, err := OpenMP4(filename)
+		if err != nil {
+			return nil, err
+		}
+		values := f.Values()
+		for _, e := range existingFrames {
+			rv[e.field] = values[mp4ItemName(e.mp4)]
+		}
+	} else {
+		var descriptions []string
+		for _, e := range existingFrames {
+			descriptions = append(descriptions, e.id3)
+		}
+		tag, err := id3v2.Open(filename, id3v2.Options{Parse: true, ParseFrames: descriptions})
+		if err != nil {
+			return nil, err
+		}
+		defer tag.Close()
+		for _, e := range existingFrames {
+			rv[e.field] = tag.GetTextFrame(tag.CommonID(e.id3)).Text
+		}
+	}
+
+	// "3/10" -> "3", "2021-05-04" -> "2021"
+	for _, field := range []string{"disc_number", "track"} {
+		rv[field] = strings.SplitN(rv[field], "/", 2)[0]
+	}
+	if len(rv["year"]) > 4 {
+		rv["year"] = rv["year"][:4]
+	}
+	if !yearRegex.MatchString(rv["year"]) {
+		// ID3v2.4's TDRC may hold the Date or Time (ddmm or hhmm)
+		delete(rv, "year")
+	}
+	for field, value := range rv {
+		if strings.TrimSpace(value) == "" || mp4BinaryRegex.MatchString(value) {
+			delete(rv, field)
+		}
+	}
+	return rv, nil
+}
+
+// fillFromTags sets the track's empty fields to the file's existing tags, and
+// returns the fields it set
+func fillFromTags(track *Track) map[string]string {
+	tags, err := existingTags(track.Filename)
+	if err != nil {
+		log.Warnf("Cannot read the tags of %q: %s", track.Filename, err)
+		return nil
+	}
+	filled := make(map[string]string)
+	for field, value := range tags {
+		if track.Get(field) == "" {
+			log.Debugf("%q: using its %s tag: %q", track.Filename, field, value)
+			track.Set(field, value)
+			filled[field] = value
+		}
+	}
+	return filled
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/bogem/id3v2"
+)
+
+func TestExistingTags(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "track.mp3")
+	err := ioutil.WriteFile(filename, append([]byte{0xff, 0xfb, 0x90, 0x00}, make([]byte, 412)...), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag, err := id3v2.Open(filename, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag.SetTitle("Title")
+	tag.SetArtist("Artist")
+	tag.SetYear("2019-05-04")
+	tag.AddTextFrame("TRCK", id3v2.EncodingUTF8, "3/10")
+	tag.AddTextFrame("TPOS", id3v2.EncodingUTF8, "")
+	err = tag.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag.Close()
+
+	got, err := existingTags(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"title": "Title", "artist": "Artist", "year": "2019", "track": "3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("existingTags() = %v, want %v", got, want)
+	}
+}
@@ -3,7 +3,6 @@ module github.com/rasa/feedster
 require (
 	github.com/360EntSecGroup-Skylar/excelize v1.4.0
 	github.com/bogem/id3v2 v1.1.1
-	github.com/eduncan911/podcast v1.3.1-0.20170513192611-39a754964aa4
 	github.com/gocarina/gocsv v0.0.0-20190313153828-c075544dca88
 	github.com/mattn/go-colorable v0.0.9
 	github.com/mattn/go-isatty v0.0.4 // indirect
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	guidsFileMask = "%s-guids.json"
+	guidsVersion  = 1
+)
+
+// GUIDRegistry holds the GUID assigned to each track, keyed by the track's
+// original filename, so GUIDs survive changes to rename_mask and base_url
+type GUIDRegistry struct {
+	Version int               `json:"version"`
+	GUIDs   map[string]string `json:"guids"`
+	// Feed is the feed's podcast:guid, which must not change if the feed moves
+	Feed string `json:"feed,omitempty"`
+
+	filename string
+	// GUIDs found in the existing feed, keyed by enclosure URL
+	feedGUIDs map[string]string
+	// keys that were given each GUID in this run
+	seen  map[string]string
+	dirty bool
+}
+
+var guids *GUIDRegistry
+
+// loadGUIDs reads the registry in filename, and the GUIDs in the existing feedFile,
+// so feeds generated before the registry existed keep their GUIDs
+func loadGUIDs(filename string, feedFile string) (r *GUIDRegistry) {
+	r = &GUIDRegistry{
+		Version:   guidsVersion,
+		GUIDs:     make(map[string]string),
+		filename:  filename,
+		feedGUIDs: make(map[string]string),
+		seen:      make(map[string]string),
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err == nil {
+		err = json.Unmarshal(data, r)
+		if err != nil {
+			log.Fatalf("Cannot process %q: %s", filename, err)
+		}
+		if r.GUIDs == nil {
+			r.GUIDs = make(map[string]string)
+		}
+		log.Debugf("Read %d GUIDs from %q", len(r.GUIDs), filename)
+	} else if !os.IsNotExist(err) {
+		log.Fatalf("Cannot read %q: %s", filename, err)
+	}
+
+	data, err = ioutil.ReadFile(feedFile)
+	if err != nil {
+		return r
+	}
+	var feed struct {
+		Items []struct {
+			GUID      string `xml:"guid"`
+			Enclosure struct {
+				URL string `xml:"url,attr"`
+			} `xml:"enclosure"`
+		} `xml:"channel>item"`
+	}
+	err = xml.Unmarshal(data, &feed)
+	if err != nil {
+		log.Warnf("Cannot process %q: %s", feedFile, err)
+		return r
+	}
+	for _, item := range feed.Items {
+		if item.GUID != "" && item.Enclosure.URL != "" {
+			r.feedGUIDs[item.Enclosure.URL] = item.GUID
+		}
+	}
+	return r
+}
+
+// newGUID returns a random (version 4) UUID
+func newGUID() string {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		log.Fatalf("Cannot generate GUID: %s", err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// GUID returns the track's GUID: the guid column, if set, otherwise the GUID
+// assigned on a previous run, otherwise the GUID the existing feed used for
+// enclosureURL, otherwise a new random one
+func (r *GUIDRegistry) GUID(track *Track, enclosureURL string) string {
+	key := track.OriginalFilename
+	if key == "" {
+		key = track.Filename
+	}
+
+	guid := track.GUID
+	if guid == "" {
+		guid = r.GUIDs[key]
+	}
+	if guid == "" {
+		guid = r.feedGUIDs[enclosureURL]
+	}
+	if guid == "" {
+		guid = newGUID()
+	}
+
+	if r.GUIDs[key] != guid {
+		if r.GUIDs[key] != "" {
+			log.Warnf("Changing GUID for %q from %q to %q", key, r.GUIDs[key], guid)
+		} else {
+			log.Debugf("Assigning GUID %q to %q", guid, key)
+		}
+		if dryRun {
+			planGUID(key, guid)
+		}
+		r.GUIDs[key] = guid
+		r.dirty = true
+	}
+	if other, ok := r.seen[guid]; ok && other != key {
+		log.Warnf("Duplicate GUID %q for %q and %q", guid, other, key)
+	}
+	r.seen[guid] = key
+	return guid
+}
+
+// FeedGUID returns the podcast:guid assigned on a previous run, if any,
+// otherwise it records and returns guid
+func (r *GUIDRegistry) FeedGUID(guid string) string {
+	if r.Feed != "" && r.Feed != guid {
+		log.Debugf("Keeping podcast:guid %q (not %q)", r.Feed, guid)
+		return r.Feed
+	}
+	if r.Feed == "" && guid != "" {
+		if dryRun {
+			planGUID("podcast:guid", guid)
+		}
+		r.Feed = guid
+		r.dirty = true
+	}
+	return guid
+}
+
+// Save writes the registry, if any GUIDs were assigned
+func (r *GUIDRegistry) Save() {
+	if !r.dirty {
+		return
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		log.Fatalf("Cannot process %q: %s", r.filename, err)
+	}
+	log.Infof("Saving %d GUIDs to %q", len(r.GUIDs), r.filename)
+	err = ioutil.WriteFile(r.filename, data, 0644)
+	if err != nil {
+		log.Fatalf("Cannot write %q: %s", r.filename, err)
+	}
+	r.dirty = false
+}
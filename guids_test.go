@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+var uuidV4Regex = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestGUIDRegistry(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "show-guids.json")
+	feedFile := filepath.Join(dir, "show.xml")
+	feed := `<rss><channel>
+<item><guid isPermaLink="false">old-guid</guid><enclosure url="https://example.com/two.mp3"/></item>
+</channel></rss>`
+	if err := ioutil.WriteFile(feedFile, []byte(feed), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		track *Track
+		url   string
+		want  string
+	}{
+		// a new track gets a random GUID
+		{&Track{Filename: "one.mp3"}, "https://example.com/one.mp3", ""},
+		// a track in the existing feed keeps its GUID
+		{&Track{Filename: "two.mp3"}, "https://example.com/two.mp3", "old-guid"},
+		// the guid column wins
+		{&Track{Filename: "three.mp3", GUID: "column-guid"}, "https://example.com/three.mp3", "column-guid"},
+		// the registry is keyed by the original filename, not the output name
+		{&Track{Filename: "Show-04.mp3", OriginalFilename: "four.mp3"}, "https://example.com/Show-04.mp3", ""},
+	}
+
+	r := loadGUIDs(filename, feedFile)
+	got := make(map[string]string)
+	for _, tt := range tests {
+		guid := r.GUID(tt.track, tt.url)
+		switch {
+		case tt.want == "" && !uuidV4Regex.MatchString(guid):
+			t.Errorf("GUID(%q) = %q, want a random UUID", tt.track.Filename, guid)
+		case tt.want != "" && guid != tt.want:
+			t.Errorf("GUID(%q) = %q, want %q", tt.track.Filename, guid, tt.want)
+		}
+		got[tt.track.Filename] = guid
+	}
+	feedGUID := r.FeedGUID("feed-guid")
+	r.Save()
+
+	// the GUIDs survive a new base_url, and rename_mask, and a lost feed
+	r = loadGUIDs(filename, filepath.Join(dir, "missing.xml"))
+	for _, tt := range tests {
+		track := *tt.track
+		track.Filename = "renamed-" + track.Filename
+		if track.OriginalFilename == "" {
+			track.OriginalFilename = tt.track.Filename
+		}
+		if guid := r.GUID(&track, "https://example.net/"+track.Filename); guid != got[tt.track.Filename] {
+			t.Errorf("after loading, GUID(%q) = %q, want %q", tt.track.Filename, guid, got[tt.track.Filename])
+		}
+	}
+	if guid := r.FeedGUID("other-guid"); guid != feedGUID {
+		t.Errorf("after loading, FeedGUID() = %q, want %q", guid, feedGUID)
+	}
+	if r.dirty {
+		t.Errorf("after loading, the unchanged registry is dirty")
+	}
+}
@@ -0,0 +1,428 @@
+package main
+
+// feedster import: create a project from an existing podcast's RSS feed
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	fpodcast "github.com/rasa/feedster/podcast"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// readFeed reads the feed in filename, which may be a URL
+func readFeed(filename string) ([]byte, error) {
+	if !strings.Contains(filename, "://") {
+		return ioutil.ReadFile(filename)
+	}
+	resp, err := http.Get(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// urlFilename returns the filename at the end of rawURL's path
+func urlFilename(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	name := path.Base(u.Path)
+	if name == "." || name == "/" {
+		return ""
+	}
+	return name
+}
+
+// urlDir returns rawURL, less the filename at the end of its path
+func urlDir(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	u.RawQuery = ""
+	u.Fragment = ""
+	s := u.String()
+	return s[:strings.LastIndex(s, "/")+1]
+}
+
+// importBaseURL returns the directory most of the enclosures are in, so
+// their URLs are base_url plus their filenames
+func importBaseURL(items []*fpodcast.Item) string {
+	counts := make(map[string]int)
+	baseURL := ""
+	for _, item := range items {
+		dir := urlDir(item.Enclosure.URL)
+		counts[dir]++
+		if counts[dir] > counts[baseURL] {
+			baseURL = dir
+		}
+	}
+	return baseURL
+}
+
+// importCategories returns the feed's categories as the category field
+func importCategories(p *fpodcast.Podcast) (l CategoryList) {
+	for _, c := range p.ICategories {
+		category := Category{Name: c.Text}
+		for _, sub := range c.ICategories {
+			category.Subcategories = append(category.Subcategories, sub.Text)
+		}
+		l = append(l, category)
+	}
+	if len(l) == 0 {
+		l = parseCategory(p.Category)
+	}
+	return l
+}
+
+// importTrack returns item as a row of the tracks file
+func importTrack(item *fpodcast.Item, filename string, imageURL string) *Track {
+	track := &Track{
+		Filename:    filename,
+		Artist:      item.IAuthor,
+		Description: item.Description,
+		Episode:     item.IEpisode,
+		EpisodeType: item.IEpisodeType,
+		PubDate:     item.PubDateFormatted,
+		Season:      item.ISeason,
+		Subtitle:    item.ISubtitle,
+		Title:       item.Title,
+	}
+	if item.GUIDFormatted != nil {
+		track.GUID = item.GUIDFormatted.Text
+	}
+	if item.ISummary != nil {
+		track.Summary = item.ISummary.Text
+	}
+	if track.Season == "" && item.PSeason != nil && item.PSeason.Number > 0 {
+		track.Season = fmt.Sprintf("%d", item.PSeason.Number)
+	}
+	if track.Episode == "" && item.PEpisode != nil {
+		track.Episode = item.PEpisode.Number
+	}
+	if item.IImage != nil && item.IImage.HREF != imageURL {
+		track.Image = normalizeFilename(urlFilename(item.IImage.HREF))
+	}
+	if len(item.PTranscripts) > 0 {
+		// the transcript column holds one transcript
+		track.Transcript = item.PTranscripts[0].URL
+	}
+	if item.PChapters != nil {
+		track.Chapters = item.PChapters.URL
+	}
+	var persons []string
+	for _, p := range item.PPersons {
+		if p.Role != "" {
+			persons = append(persons, fmt.Sprintf("%s (%s)", p.Text, p.Role))
+		} else {
+			persons = append(persons, p.Text)
+		}
+	}
+	track.Person = strings.Join(persons, "; ")
+	return track
+}
+
+// importTracks returns the feed's items, oldest first, as the rows of the
+// tracks file, and the URLs of the files they use, keyed by filename
+func importTracks(p *fpodcast.Podcast, baseURL string, imageURL string) (tracks []*Track, files map[string]string) {
+	items := append([]*fpodcast.Item(nil), p.Items...)
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].PubDate == nil || items[j].PubDate == nil {
+			return items[i].PubDate != nil
+		}
+		return items[i].PubDate.Before(*items[j].PubDate)
+	})
+
+	files = make(map[string]string)
+	for _, item := range items {
+		if item.Enclosure == nil {
+			log.Warnf("Skipping %q: it has no enclosure", item.Title)
+			continue
+		}
+		filename := normalizeFilename(urlFilename(item.Enclosure.URL))
+		if files[filename] != "" {
+			log.Warnf("Skipping %q: %q is also saved as %q", item.Enclosure.URL, files[filename], filename)
+			continue
+		}
+		files[filename] = item.Enclosure.URL
+		if baseURL+filename != item.Enclosure.URL {
+			log.Warnf("%q: the enclosure's URL will change to %q", item.Title, baseURL+filename)
+		}
+		track := importTrack(item, filename, imageURL)
+		if track.Image != "" {
+			files[track.Image] = item.IImage.HREF
+		}
+		tracks = append(tracks, track)
+	}
+	return tracks, files
+}
+
+// setTemplateKey sets key to value in the .yaml template s, replacing the
+// key, and its indented lines, or, if it is commented out, the comment
+func setTemplateKey(s string, key string, value interface{}) string {
+	data, err := yaml.Marshal(yaml.MapSlice{{Key: key, Value: value}})
+	if err != nil {
+		log.Fatalf("Cannot encode %q: %s", key, err)
+	}
+	for _, pattern := range []string{`(?m)^%s:[^\n]*\n(?:[ \t]+[^\n]*\n)*`, `(?m)^# ?%s:[ \t]*\n`} {
+		re := regexp.MustCompile(fmt.Sprintf(pattern, regexp.QuoteMeta(key)))
+		if loc := re.FindStringIndex(s); loc != nil {
+			return s[:loc[0]] + string(data) + s[loc[1]:]
+		}
+	}
+	return s + string(data)
+}
+
+// setTemplateKeys sets the keys in the .yaml template s, whose values are set
+func setTemplateKeys(s string, values yaml.MapSlice) string {
+	for _, item := range values {
+		switch v := item.Value.(type) {
+		case string:
+			if v == "" {
+				continue
+			}
+		case yaml.MapSlice:
+			empty := true
+			for _, field := range v {
+				if field.Value != "" {
+					empty = false
+				}
+			}
+			if empty {
+				continue
+			}
+		case CategoryList:
+			if len(v) == 0 {
+				continue
+			}
+		case []yaml.MapSlice:
+			if len(v) == 0 {
+				continue
+			}
+		}
+		s = setTemplateKey(s, item.Key.(string), item.Value)
+	}
+	return s
+}
+
+// downloadFile saves the file at rawURL as filename, unless it exists
+func downloadFile(rawURL string, filename string) error {
+	if _, err := os.Stat(filename); err == nil {
+		log.Debugf("%q already exists", filename)
+		return nil
+	}
+	if dryRun {
+		planCopy(rawURL, filename)
+		return nil
+	}
+	log.Infof("Downloading %q to %q", rawURL, filename)
+	resp, err := http.Get(rawURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	tmp := filename + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, resp.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+// importFeed creates <name>.yaml, <name>-podcast.yaml and <name>-tracks.csv
+// (or .xlsx) from the feed in args, keeping its items' GUIDs, publication
+// dates and descriptions, and naming their files after their enclosures' URLs
+func importFeed(args []string) int {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	download := flags.Bool("download", false, "download the episodes, and images, that are not in the current directory")
+	force := flags.Bool("force", false, "overwrite existing files")
+	xlsx := flags.Bool("xlsx", false, "create an .xlsx tracks file, instead of a .csv file")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: feedster import [-download] [-force] [-xlsx] feed.xml [name]\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		flags.Usage()
+		return 2
+	}
+	feedFile := flags.Arg(0)
+	name := basename(path.Base(feedFile))
+	if flags.NArg() > 1 {
+		name = strings.TrimSuffix(flags.Arg(1), ".yaml")
+	}
+
+	ext := ".csv"
+	if *xlsx {
+		ext = ".xlsx"
+	}
+	yamlFile := name + ".yaml"
+	podcastFile := fmt.Sprintf(podcastFileMask, name)
+	tracksFile := fmt.Sprintf(tracksFileMask, name, ext)
+	if filename := firstExisting(yamlFile, podcastFile, tracksFile); filename != "" && !*force {
+		log.Errorf("Cannot create %q: it already exists (use -force to overwrite it)", filename)
+		return 1
+	}
+
+	log.Infof("Reading %q", feedFile)
+	data, err := readFeed(feedFile)
+	if err != nil {
+		log.Errorf("Cannot read %q: %s", feedFile, err)
+		return 1
+	}
+	p, err := fpodcast.Decode(bytes.NewReader(data))
+	if err != nil {
+		log.Errorf("Cannot process %q: %s", feedFile, err)
+		return 1
+	}
+	var items []*fpodcast.Item
+	for _, item := range p.Items {
+		if item.Enclosure == nil || urlFilename(item.Enclosure.URL) == "" {
+			log.Warnf("Skipping %q: it has no enclosure", item.Title)
+			continue
+		}
+		items = append(items, item)
+	}
+	if len(items) == 0 {
+		log.Errorf("Cannot find any episodes in %q", feedFile)
+		return 1
+	}
+	p.Items = items
+
+	imageURL := ""
+	if p.IImage != nil {
+		imageURL = p.IImage.HREF
+	} else if p.Image != nil {
+		imageURL = p.Image.URL
+	}
+	baseURL := importBaseURL(items)
+	tracks, files := importTracks(p, baseURL, imageURL)
+	image := urlFilename(imageURL)
+	if image != "" {
+		files[image] = imageURL
+	}
+
+	if *xlsx {
+		data, err = tracksXLSX(tracks)
+	} else {
+		data, err = tracksCSV(tracks)
+	}
+	if err != nil {
+		log.Fatalf("Cannot create %q: %s", tracksFile, err)
+	}
+
+	author := p.IAuthor
+	email := ""
+	var owner yaml.MapSlice
+	if p.IOwner != nil {
+		if author == "" {
+			author = p.IOwner.Name
+		}
+		email = p.IOwner.Email
+		owner = yaml.MapSlice{{Key: "name", Value: p.IOwner.Name}, {Key: "email", Value: p.IOwner.Email}}
+	}
+
+	s := string(initTemplate(defaultYAML, yamlFile, "", ""))
+	s = setTemplateKeys(s, yaml.MapSlice{
+		{Key: "base_url", Value: baseURL},
+		{Key: "author", Value: author},
+		{Key: "email", Value: email},
+		{Key: "image", Value: image},
+		{Key: "language", Value: p.Language},
+	})
+	writeInitFile(yamlFile, []byte(s))
+
+	summary := yaml.MapSlice{{Key: "text", Value: ""}}
+	if p.ISummary != nil {
+		summary[0].Value = p.ISummary.Text
+	}
+	var locked, license, location yaml.MapSlice
+	if p.PLocked != nil {
+		locked = yaml.MapSlice{{Key: "text", Value: p.PLocked.Text}, {Key: "owner", Value: p.PLocked.Owner}}
+	}
+	if p.PLicense != nil {
+		license = yaml.MapSlice{{Key: "text", Value: p.PLicense.Text}, {Key: "url", Value: p.PLicense.URL}}
+	}
+	if p.PLocation != nil {
+		location = yaml.MapSlice{{Key: "text", Value: p.PLocation.Text}, {Key: "geo", Value: p.PLocation.Geo}, {Key: "osm", Value: p.PLocation.OSM}}
+	}
+	var funding []yaml.MapSlice
+	for _, f := range p.PFunding {
+		funding = append(funding, yaml.MapSlice{{Key: "url", Value: f.URL}, {Key: "text", Value: f.Text}})
+	}
+	s = string(initTemplate("default-podcast.yaml", podcastFile, "", ""))
+	s = setTemplateKeys(s, yaml.MapSlice{
+		{Key: "title", Value: p.Title},
+		{Key: "link", Value: p.Link},
+		{Key: "description", Value: p.Description},
+		{Key: "iauthor", Value: p.IAuthor},
+		{Key: "iowner", Value: owner},
+		{Key: "category", Value: importCategories(p)},
+		{Key: "copyright", Value: p.Copyright},
+		{Key: "isubtitle", Value: p.ISubtitle},
+		{Key: "isummary", Value: summary},
+		{Key: "iexplicit", Value: p.IExplicit},
+		{Key: "icomplete", Value: p.IComplete},
+		{Key: "language", Value: p.Language},
+		{Key: "iblock", Value: p.IBlock},
+		{Key: "inewfeedurl", Value: p.INewFeedURL},
+		{Key: "pguid", Value: p.PGUID},
+		{Key: "plocked", Value: locked},
+		{Key: "pfunding", Value: funding},
+		{Key: "plicense", Value: license},
+		{Key: "plocation", Value: location},
+	})
+	writeInitFile(podcastFile, []byte(s))
+	writeInitFile(tracksFile, data)
+	log.Infof("Listed %d episodes in %q", len(tracks), tracksFile)
+
+	var filenames []string
+	for filename := range files {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	missing := 0
+	for _, filename := range filenames {
+		if *download {
+			err = downloadFile(files[filename], filename)
+			if err != nil {
+				log.Errorf("Cannot download %q: %s", files[filename], err)
+				missing++
+			}
+		} else if _, err := os.Stat(filename); err != nil {
+			log.Warnf("%q is missing: download it from %q (or use -download)", filename, files[filename])
+		}
+	}
+	if missing > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	fpodcast "github.com/rasa/feedster/podcast"
+	"gopkg.in/yaml.v2"
+)
+
+func TestSetTemplateKey(t *testing.T) {
+	template := "# base_url: the site\nbase_url:\n\n# default: none\n# author:\n\niowner:\n  name:\n  email:\n\nlast:\n"
+	got := setTemplateKeys(template, yaml.MapSlice{
+		{Key: "base_url", Value: "https://example.com/"},
+		{Key: "author", Value: "Jane: Doe"},
+		{Key: "iowner", Value: yaml.MapSlice{{Key: "name", Value: "Jane"}, {Key: "email", Value: ""}}},
+		{Key: "email", Value: ""},
+		{Key: "title", Value: "Show"},
+	})
+	want := "# base_url: the site\nbase_url: https://example.com/\n\n# default: none\nauthor: 'Jane: Doe'\n\niowner:\n  name: Jane\n  email: \"\"\n\nlast:\ntitle: Show\n"
+	if got != want {
+		t.Errorf("setTemplateKeys() = %q, want %q", got, want)
+	}
+}
+
+func TestURLFilename(t *testing.T) {
+	for rawURL, want := range map[string]string{
+		"https://example.com/audio/ep%201.mp3?src=rss": "ep 1.mp3",
+		"https://example.com/ep2.mp3":                  "ep2.mp3",
+		"https://example.com/":                         "",
+	} {
+		if got := urlFilename(rawURL); got != want {
+			t.Errorf("urlFilename(%q) = %q, want %q", rawURL, got, want)
+		}
+	}
+}
+
+func TestImportTracks(t *testing.T) {
+	feed := `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd"><channel>
+<title>Show</title>
+<itunes:image href="https://cdn.example.com/show.jpg"/>
+<item>
+	<title>Three</title>
+	<guid isPermaLink="false">guid-3</guid>
+	<description><![CDATA[<p>Three &amp; more</p>]]></description>
+	<pubDate>Wed, 03 Jan 2024 10:00:00 +0000</pubDate>
+	<enclosure url="https://cdn.example.com/ep3.mp3" length="3" type="audio/mpeg"/>
+	<itunes:image href="https://cdn.example.com/art/ep%3A3.jpg?w=3000"/>
+</item>
+<item>
+	<title>Undated</title>
+	<guid>guid-0</guid>
+	<description>Undated</description>
+	<enclosure url="https://example.com/show/ep0.mp3" length="1" type="audio/mpeg"/>
+	<itunes:image href="https://cdn.example.com/show.jpg"/>
+</item>
+<item>
+	<title>One</title>
+	<guid>guid-1</guid>
+	<description>One</description>
+	<pubDate>Mon, 01 Jan 2024 10:00:00 +0000</pubDate>
+	<enclosure url="https://example.com/show/ep1.mp3" length="1" type="audio/mpeg"/>
+</item>
+<item>
+	<title>Two</title>
+	<guid>guid-2</guid>
+	<pubDate>Tue, 02 Jan 2024 10:00:00 +0000</pubDate>
+	<enclosure url="https://other.example.com/ep1.mp3" length="2" type="audio/mpeg"/>
+</item>
+<item>
+	<title>No enclosure</title>
+	<pubDate>Tue, 02 Jan 2024 11:00:00 +0000</pubDate>
+</item>
+</channel></rss>`
+	p, err := fpodcast.Decode(strings.NewReader(feed))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tracks, files := importTracks(p, "https://example.com/show/", "https://cdn.example.com/show.jpg")
+	want := []*Track{
+		// oldest first, and "Two" is skipped, as it is also saved as ep1.mp3
+		{Filename: "ep1.mp3", Title: "One", GUID: "guid-1", Description: "One", PubDate: "Mon, 01 Jan 2024 10:00:00 +0000"},
+		{Filename: "ep3.mp3", Title: "Three", GUID: "guid-3", Description: "<p>Three &amp; more</p>", PubDate: "Wed, 03 Jan 2024 10:00:00 +0000", Image: "ep_3.jpg"},
+		// undated episodes go last, and the show's image is not an episode's
+		{Filename: "ep0.mp3", Title: "Undated", GUID: "guid-0", Description: "Undated"},
+	}
+	if len(tracks) != len(want) {
+		t.Fatalf("importTracks() returned %d tracks, want %d", len(tracks), len(want))
+	}
+	for i, track := range tracks {
+		if !reflect.DeepEqual(track, want[i]) {
+			t.Errorf("importTracks()[%d] = %+v, want %+v", i, track, want[i])
+		}
+	}
+
+	wantFiles := map[string]string{
+		"ep0.mp3":  "https://example.com/show/ep0.mp3",
+		"ep1.mp3":  "https://example.com/show/ep1.mp3",
+		"ep3.mp3":  "https://cdn.example.com/ep3.mp3",
+		"ep_3.jpg": "https://cdn.example.com/art/ep%3A3.jpg?w=3000",
+	}
+	if !reflect.DeepEqual(files, wantFiles) {
+		t.Errorf("importTracks() files = %v, want %v", files, wantFiles)
+	}
+}
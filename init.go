@@ -0,0 +1,339 @@
+package main
+
+// feedster init: create a project's .yaml and tracks files from a directory of audio files
+
+import (
+	"bytes"
+	"embed"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/360EntSecGroup-Skylar/excelize"
+	log "github.com/sirupsen/logrus"
+)
+
+// templates are the files feedster init copies, and renames, for a new project
+//
+//go:embed default.yaml default-podcast.yaml default-tracks.csv
+var templates embed.FS
+
+const initSheetName = "Sheet1"
+
+// initExtensions are the extensions of the files feedster can publish
+var initExtensions = map[string]bool{
+	".m4a": true,
+	".m4b": true,
+	".m4v": true,
+	".mov": true,
+	".mp3": true,
+	".mp4": true,
+}
+
+// naturalLess returns true if a sorts before b, comparing runs of digits by
+// their value, so "track2.mp3" sorts before "track10.mp3"
+func naturalLess(a, b string) bool {
+	a = strings.ToLower(a)
+	b = strings.ToLower(b)
+	for a != "" && b != "" {
+		if isDigit(a[0]) && isDigit(b[0]) {
+			i := digitsEnd(a)
+			j := digitsEnd(b)
+			na := strings.TrimLeft(a[:i], "0")
+			nb := strings.TrimLeft(b[:j], "0")
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			if na != nb {
+				return na < nb
+			}
+			if i != j {
+				// "01" sorts before "1"
+				return i > j
+			}
+			a = a[i:]
+			b = b[j:]
+			continue
+		}
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a = a[1:]
+		b = b[1:]
+	}
+	return len(a) < len(b)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// digitsEnd returns the length of the run of digits at the start of s
+func digitsEnd(s string) int {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return i
+}
+
+// findAudioFiles returns the audio files in dir, in natural sort order, with
+// dir in their names. Files whose names feedster would change (see
+// normalizeFilename) are skipped
+func findAudioFiles(dir string, sources map[string]bool) (filenames []string, err error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, fi := range files {
+		name := fi.Name()
+		ext := strings.ToLower(filepath.Ext(name))
+		if fi.IsDir() || strings.HasPrefix(name, ".") || !(initExtensions[ext] || sources[ext]) {
+			continue
+		}
+		if normalized := normalizeFilename(name); normalized != name {
+			log.Warnf("Skipping %q: rename it to %q, to publish it", name, normalized)
+			continue
+		}
+		// "audio/episode1.mp3"
+		filenames = append(filenames, path.Join(filepath.ToSlash(dir), name))
+	}
+	sort.SliceStable(filenames, func(i, j int) bool { return naturalLess(filenames[i], filenames[j]) })
+	return filenames, nil
+}
+
+// titleFromFilename returns filename's name, less its extension, with
+// underscores replaced by spaces
+func titleFromFilename(filename string) string {
+	title := strings.Replace(basename(path.Base(filename)), "_", " ", -1)
+	return strings.Join(strings.Fields(title), " ")
+}
+
+// initTracks returns a track for each of filenames, with its existing tags,
+// and duration, numbering the tracks without a track tag in order. Tracks
+// that are too short to publish are skipped
+func initTracks(filenames []string, sources map[string]bool) (tracks []*Track, masters int) {
+	for _, filename := range filenames {
+		track := &Track{Filename: filename}
+		if sources[strings.ToLower(path.Ext(filename))] {
+			// encoded per the transcode section
+			masters++
+		} else {
+			enclosureType := getEnclosureType(filename)
+			track.DurationMilliseconds, _ = getDuration(filename, enclosureType)
+			if track.DurationMilliseconds > 0 && track.DurationMilliseconds < minMilliseconds {
+				log.Warnf("Skipping %q: it is only %d milliseconds in duration, >=%d required", filename, track.DurationMilliseconds, minMilliseconds)
+				continue
+			}
+			fillFromTags(track)
+		}
+		if track.Title == "" {
+			track.Title = titleFromFilename(filename)
+		}
+		if track.Track == "" {
+			track.Track = fmt.Sprintf("%d", len(tracks)+1)
+		}
+		duration := "--:--:--"
+		if track.DurationMilliseconds > 0 {
+			duration = track.Duration()
+			track.Length = duration
+		}
+		log.Infof("%3s %s %q (%s)", track.Track, duration, track.Title, filename)
+		tracks = append(tracks, track)
+	}
+	return tracks, masters
+}
+
+// tracksColumns returns the columns of the default-tracks.csv template
+func tracksColumns() []string {
+	data, err := templates.ReadFile("default-tracks.csv")
+	if err != nil {
+		log.Fatalf("Cannot read %q: %s", "default-tracks.csv", err)
+	}
+	return strings.Split(strings.TrimSpace(string(data)), ",")
+}
+
+// tracksRows returns the tracks as rows, with the columns as the first row:
+// the template's columns, and any other column that is set in a track
+func tracksRows(tracks []*Track) (rows [][]string) {
+	columns := tracksColumns()
+	seen := make(map[string]bool)
+	for _, column := range columns {
+		seen[column] = true
+	}
+	t := reflect.TypeOf(Track{})
+	for i := 0; i < t.NumField(); i++ {
+		column := strings.Split(t.Field(i).Tag.Get("csv"), ",")[0]
+		if column == "" || seen[column] {
+			continue
+		}
+		for _, track := range tracks {
+			if track.Get(column) != "" {
+				columns = append(columns, column)
+				break
+			}
+		}
+	}
+	rows = append(rows, columns)
+	for _, track := range tracks {
+		row := make([]string, len(columns))
+		for i, column := range columns {
+			row[i] = track.Get(column)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// tracksCSV returns the tracks as a tracks file, in CSV format
+func tracksCSV(tracks []*Track) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	err := w.WriteAll(tracksRows(tracks))
+	return buf.Bytes(), err
+}
+
+// tracksXLSX returns the tracks as a tracks file, in Excel format
+func tracksXLSX(tracks []*Track) ([]byte, error) {
+	xlsx := excelize.NewFile()
+	for i, row := range tracksRows(tracks) {
+		row := row
+		xlsx.SetSheetRow(initSheetName, fmt.Sprintf("A%d", i+1), &row)
+	}
+	var buf bytes.Buffer
+	err := xlsx.Write(&buf)
+	return buf.Bytes(), err
+}
+
+// podcastTitle returns the tracks' album title, if they all have the same
+// one, or else name
+func podcastTitle(tracks []*Track, name string) string {
+	title := ""
+	for _, track := range tracks {
+		if track.AlbumTitle == "" || (title != "" && track.AlbumTitle != title) {
+			return name
+		}
+		title = track.AlbumTitle
+	}
+	if title == "" {
+		return name
+	}
+	return title
+}
+
+// initTemplate returns the template named templateName, with its first line,
+// the template's name, replaced by filename, and old replaced by new
+func initTemplate(templateName string, filename string, old string, new string) []byte {
+	data, err := templates.ReadFile(templateName)
+	if err != nil {
+		log.Fatalf("Cannot read %q: %s", templateName, err)
+	}
+	s := strings.Replace(string(data), "# "+templateName, "# "+filename, 1)
+	if old != "" {
+		s = strings.Replace(s, old, new, 1)
+	}
+	return []byte(s)
+}
+
+// firstExisting returns the first of filenames that exists, or ""
+func firstExisting(filenames ...string) string {
+	for _, filename := range filenames {
+		if _, err := os.Stat(filename); err == nil {
+			return filename
+		}
+	}
+	return ""
+}
+
+// writeInitFile writes data to filename
+func writeInitFile(filename string, data []byte) {
+	if dryRun {
+		planFeed(filename, data)
+		return
+	}
+	log.Infof("Creating %q", filename)
+	err := ioutil.WriteFile(filename, data, 0644)
+	if err != nil {
+		log.Fatalf("Cannot write %q: %s", filename, err)
+	}
+}
+
+// initProject creates <name>.yaml, <name>-podcast.yaml and <name>-tracks.csv
+// (or .xlsx), in the current directory, listing the audio files in the
+// directory in args
+func initProject(args []string) int {
+	flags := flag.NewFlagSet("init", flag.ExitOnError)
+	force := flags.Bool("force", false, "overwrite existing files")
+	xlsx := flags.Bool("xlsx", false, "create an .xlsx tracks file, instead of a .csv file")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: feedster init [-force] [-xlsx] name [directory]\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		flags.Usage()
+		return 2
+	}
+	name := strings.TrimSuffix(flags.Arg(0), ".yaml")
+	dir := "."
+	if flags.NArg() > 1 {
+		dir = flags.Arg(1)
+	}
+
+	ext := ".csv"
+	if *xlsx {
+		ext = ".xlsx"
+	}
+	yamlFile := name + ".yaml"
+	podcastFile := fmt.Sprintf(podcastFileMask, name)
+	tracksFile := fmt.Sprintf(tracksFileMask, name, ext)
+	if filename := firstExisting(yamlFile, podcastFile, tracksFile); filename != "" && !*force {
+		log.Errorf("Cannot create %q: it already exists (use -force to overwrite it)", filename)
+		return 1
+	}
+
+	defaults = initDefaults
+	err := defaults.Transcode.parse()
+	if err != nil {
+		log.Fatalf("Cannot parse transcode in %q: %s", defaultYAML, err)
+	}
+	filenames, err := findAudioFiles(dir, defaults.Transcode.sources)
+	if err != nil {
+		log.Errorf("Cannot read %q: %s", dir, err)
+		return 1
+	}
+	if len(filenames) == 0 {
+		log.Errorf("Cannot find any audio files in %q", dir)
+		return 1
+	}
+	tracks, masters := initTracks(filenames, defaults.Transcode.sources)
+
+	var data []byte
+	if *xlsx {
+		data, err = tracksXLSX(tracks)
+	} else {
+		data, err = tracksCSV(tracks)
+	}
+	if err != nil {
+		log.Fatalf("Cannot create %q: %s", tracksFile, err)
+	}
+
+	writeInitFile(yamlFile, initTemplate(defaultYAML, yamlFile, "", ""))
+	title := fmt.Sprintf("\ntitle: %q\n", podcastTitle(tracks, name))
+	writeInitFile(podcastFile, initTemplate("default-podcast.yaml", podcastFile, "\ntitle:\n", title))
+	writeInitFile(tracksFile, data)
+
+	log.Infof("Listed %d tracks in %q", len(tracks), tracksFile)
+	if masters > 0 {
+		log.Infof("Set the transcode section's codec in %q, to encode the recordings (%d files)", yamlFile, masters)
+	}
+	log.Infof("Fill in base_url in %q, and link and description in %q, then run feedster %s", yamlFile, podcastFile, yamlFile)
+	return 0
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestNaturalLess(t *testing.T) {
+	got := []string{"track10.mp3", "Track2.mp3", "track1.mp3", "intro.mp3", "track01.mp3", "track2b.mp3"}
+	sort.SliceStable(got, func(i, j int) bool { return naturalLess(got[i], got[j]) })
+	want := []string{"intro.mp3", "track01.mp3", "track1.mp3", "Track2.mp3", "track2b.mp3", "track10.mp3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("naturalLess() sorted %q, want %q", got, want)
+	}
+}
+
+func TestPodcastTitle(t *testing.T) {
+	same := []*Track{{AlbumTitle: "Show"}, {AlbumTitle: "Show"}}
+	if got := podcastTitle(same, "myshow"); got != "Show" {
+		t.Errorf("podcastTitle() = %q, want %q", got, "Show")
+	}
+	mixed := []*Track{{AlbumTitle: "Show"}, {AlbumTitle: "Other"}}
+	if got := podcastTitle(mixed, "myshow"); got != "myshow" {
+		t.Errorf("podcastTitle() = %q, want %q", got, "myshow")
+	}
+}
+
+func TestFindAudioFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"ep10.mp3", "ep2.m4a", "ep1.wav", "notes.txt", "50%.mp3", ".hidden.mp3"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := findAudioFiles(dir, map[string]bool{".wav": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefix := filepath.ToSlash(dir) + "/"
+	want := []string{prefix + "ep1.wav", prefix + "ep2.m4a", prefix + "ep10.mp3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("findAudioFiles() = %q, want %q", got, want)
+	}
+}
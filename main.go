@@ -5,11 +5,13 @@ package main
 // http://id3.org/d3v2.3.0
 
 import (
+	"bytes"
 	"encoding/csv"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"image"
+	"image/color"
 	_ "image/jpeg"
 	_ "image/png"
 	"io"
@@ -29,7 +31,6 @@ import (
 
 	"github.com/360EntSecGroup-Skylar/excelize"
 	"github.com/bogem/id3v2"
-	"github.com/eduncan911/podcast"
 	"github.com/gocarina/gocsv"
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v2"
@@ -56,54 +57,119 @@ const (
 
 // Default has default settings read from config.yaml (and local.yaml, if it exists)
 type Default struct {
-	Author         string `yaml:"author,omitempty"`
-	BaseURL        string `yaml:"base_url"`
-	Category       string `yaml:"category,omitempty"`
-	Complete       string `yaml:"complete,omitempty"`
-	Copyright      string `yaml:"copyright,omitempty"`
-	CopyrightMask  string `yaml:"copyright_mask,omitempty"`
-	DiscNumber     string `yaml:"disc_number,omitempty"`
-	Email          string `yaml:"email,omitempty"`
-	EncodedBy      string `yaml:"encoded_by,omitempty"`
-	Exiftool       string `yaml:"exiftool,omitempty"`
-	Explicit       string `yaml:"explicit,omitempty"`
-	Ffmpeg         string `yaml:"ffmpeg,omitempty"`
-	Ffprobe        string `yaml:"ffprobe,omitempty"`
-	Generator      string `yaml:"generator,omitempty"`
-	Image          string `yaml:"image,omitempty"`
-	Language       string `yaml:"language,omitempty"`
-	ManagingEditor string `yaml:"managingeditor,omitempty"`
-	OutputDir      string `yaml:"output_dir,omitempty"`
-	OutputFile     string `yaml:"output_file,omitempty"`
-	PodcastFile    string `yaml:"podcast_file,omitempty"`
-	RenameMask     string `yaml:"rename_mask,omitempty"`
-	TotalDiscs     string `yaml:"total_discs,omitempty"`
-	TotalTracks    string `yaml:"total_tracks,omitempty"`
-	TrackNo        string `yaml:"track_no,omitempty"`
-	TracksFile     string `yaml:"tracks_file,omitempty"`
-	TTL            string `yaml:"ttl,omitempty"`
-	WebMaster      string `yaml:"webmaster,omitempty"`
-	totalDiscs     bool
-	totalTracks    bool
+	AtomFile            string       `yaml:"atom_file,omitempty"`
+	Author              string       `yaml:"author,omitempty"`
+	AutoSeason          string       `yaml:"auto_season,omitempty"`
+	BaseURL             string       `yaml:"base_url"`
+	Cache               string       `yaml:"cache,omitempty"`
+	Captions            string       `yaml:"captions,omitempty"`
+	Category            CategoryList `yaml:"category,omitempty"`
+	Complete            string       `yaml:"complete,omitempty"`
+	Copyright           string       `yaml:"copyright,omitempty"`
+	CopyrightMask       string       `yaml:"copyright_mask,omitempty"`
+	DescriptionTemplate string       `yaml:"description_template,omitempty"`
+	DiscImage           ImageMap     `yaml:"disc_image,omitempty"`
+	DiscNumber          string       `yaml:"disc_number,omitempty"`
+	DurationTools       string       `yaml:"duration_tools,omitempty"`
+	Email               string       `yaml:"email,omitempty"`
+	EncodedBy           string       `yaml:"encoded_by,omitempty"`
+	Exiftool            string       `yaml:"exiftool,omitempty"`
+	Explicit            string       `yaml:"explicit,omitempty"`
+	Ffmpeg              string       `yaml:"ffmpeg,omitempty"`
+	Ffprobe             string       `yaml:"ffprobe,omitempty"`
+	Generator           string       `yaml:"generator,omitempty"`
+	GUIDFile            string       `yaml:"guid_file,omitempty"`
+	Image               string       `yaml:"image,omitempty"`
+	ImageConform        string       `yaml:"image_conform,omitempty"`
+	ImageFit            string       `yaml:"image_fit,omitempty"`
+	ImagePadColor       string       `yaml:"image_pad_color,omitempty"`
+	ImageSizeMax        string       `yaml:"image_size_max,omitempty"`
+	JSONFile            string       `yaml:"json_file,omitempty"`
+	Language            string       `yaml:"language,omitempty"`
+	ManagingEditor      string       `yaml:"managingeditor,omitempty"`
+	OutputDir           string       `yaml:"output_dir,omitempty"`
+	OutputFile          string       `yaml:"output_file,omitempty"`
+	PodcastFile         string       `yaml:"podcast_file,omitempty"`
+	PreferTags          string       `yaml:"prefer_existing_tags,omitempty"`
+	Publish             Publish      `yaml:"publish,omitempty"`
+	RenameMask          string       `yaml:"rename_mask,omitempty"`
+	SeasonImage         ImageMap     `yaml:"season_image,omitempty"`
+	Site                string       `yaml:"site,omitempty"`
+	SiteTemplates       string       `yaml:"site_templates,omitempty"`
+	SubtitleTemplate    string       `yaml:"subtitle_template,omitempty"`
+	SummaryTemplate     string       `yaml:"summary_template,omitempty"`
+	TagInPlace          string       `yaml:"tag_in_place,omitempty"`
+	Timezone            string       `yaml:"timezone,omitempty"`
+	TitleTemplate       string       `yaml:"title_template,omitempty"`
+	TotalDiscs          string       `yaml:"total_discs,omitempty"`
+	TotalTracks         string       `yaml:"total_tracks,omitempty"`
+	TrackNo             string       `yaml:"track_no,omitempty"`
+	TracksFile          string       `yaml:"tracks_file,omitempty"`
+	Transcode           Transcode    `yaml:"transcode,omitempty"`
+	TranscriptSYLT      string       `yaml:"transcript_sylt,omitempty"`
+	TTL                 string       `yaml:"ttl,omitempty"`
+	WebMaster           string       `yaml:"webmaster,omitempty"`
+	artwork             *Artwork
+	autoSeason          bool
+	cache               bool
+	captions            []string
+	durationTools       bool
+	imageConform        bool
+	imagePadColor       color.RGBA
+	imageSizeMax        int64
+	location            *time.Location
+	preferTags          bool
+	site                bool
+	tagInPlace          bool
+	totalDiscs          bool
+	totalTracks         bool
+	transcriptSYLT      bool
 }
 
 var initDefaults = &Default{
+	AutoSeason:    "false",
+	Cache:         "true",
+	Captions:      "srt, vtt",
 	Complete:      "no",
 	CopyrightMask: "Copyright (c) & (p) %d, %s",
 	// This works, but some players do not display the (p) symbol (like VLC):
 	// CopyrightMask: "Copyright \u00a9 & \u2117 %d, %s",
-	DiscNumber:  "1",
-	EncodedBy:   "feedster " + version.VERSION + " (" + feedsterURL + ")",
-	Exiftool:    "exiftool",
-	Explicit:    "no",
-	Ffmpeg:      "ffmpeg",
-	Ffprobe:     "ffprobe",
-	Generator:   "feedster " + version.VERSION + " (" + feedsterURL + ")",
-	Language:    "en-us",
+	DiscNumber:    "1",
+	DurationTools: "false",
+	EncodedBy:     "feedster " + version.VERSION + " (" + feedsterURL + ")",
+	Exiftool:      "exiftool",
+	Explicit:      "no",
+	Ffmpeg:        "ffmpeg",
+	Ffprobe:       "ffprobe",
+	Generator:     "feedster " + version.VERSION + " (" + feedsterURL + ")",
+	ImageConform:  "true",
+	ImageFit:      "crop",
+	ImagePadColor: "#000000",
+	ImageSizeMax:  "512KB",
+	Language:      "en-us",
+	PreferTags:    "false",
+	Publish: Publish{
+		FeedCacheControl:  "max-age=300",
+		MediaCacheControl: "max-age=86400",
+		PathStyle:         "false",
+		Region:            "us-east-1",
+	},
+	Site:        "false",
+	TagInPlace:  "false",
+	Timezone:    "Local",
 	TotalDiscs:  "true",
 	TotalTracks: "true",
 	TrackNo:     "1",
-	TTL:         "1",
+	Transcode: Transcode{
+		Bitrate:       "128k",
+		Loudness:      "-16",
+		LoudnessRange: "11",
+		SampleRate:    "44100",
+		Sources:       "aif, aiff, flac, wav",
+		TruePeak:      "-1",
+	},
+	TranscriptSYLT: "false",
+	TTL:            "1",
 }
 
 var defaults = initDefaults
@@ -120,36 +186,124 @@ var trackFileExtensions = []string{
 call tree:
 
 main()
+	import.importFeed(args []string) int (feedster import)
+		import.readFeed(filename string) ([]byte, error)
+		fpodcast.Decode(r io.Reader) (*Podcast, error)
+		import.importTracks(p *fpodcast.Podcast, baseURL string, imageURL string) (tracks []*Track, files map[string]string)
+			import.importTrack(item *fpodcast.Item, filename string, imageURL string) *Track
+		import.setTemplateKeys(s string, values yaml.MapSlice) string
+		import.downloadFile(rawURL string, filename string) error (-download only)
+	init.initProject(args []string) int (feedster init)
+		init.findAudioFiles(dir string, sources map[string]bool) (filenames []string, err error)
+		init.initTracks(filenames []string, sources map[string]bool) (tracks []*Track, masters int)
+			getDuration(filename string, enclosureType fpodcast.EnclosureType) (durationMilliseconds int64, err error)
+			existing.fillFromTags(track *Track) map[string]string
+		init.tracksCSV(tracks []*Track) ([]byte, error)
+		init.tracksXLSX(tracks []*Track) ([]byte, error)
+	publish(args []string) int (feedster publish)
+		readYAML(yamlFile string) (fp fpodcast.Podcast)
+		s3Client.list(prefix string) (map[string]string, error)
+		publishFiles(dir string, skip string) (files []string)
+		s3Client.put(key string, data []byte, contentType string, cacheControl string) error
+	serve(args []string) int (feedster serve)
+		server.load()
+			readYAML(yamlFile string) (fp fpodcast.Podcast)
+		server.build() (-watch only)
+			feedster yamlFile (in a child process)
+			readYAML(yamlFile string) (fp fpodcast.Podcast)
+			server.inputDirs() (dirs []string)
+				getTracksFilename(yamlFile string) (tracksFile string)
+				readTracks(tracksFile string) (tracks []*Track)
+		server.watch() (-watch only)
+			inputsSignature(dirs []string) string
+			server.build()
+	validate(args []string) int (feedster validate)
+		validateXML(filename string)
+			fpodcast.Decode(r io.Reader) (*Podcast, error)
+			validation.Podcast(p *fpodcast.Podcast, imageDir string, mediaDir string)
 	processYAML(yamlFile string)
 		readYAML(yamlFile string) (fp fpodcast.Podcast)
 			loadDefaults(yamlFile string, genFilenames bool)
 			setDefaults(fp *fpodcast.Podcast)
 			processImage(fp *fpodcast.Podcast, imageName string, baseURL string) (err error)
+		cache.loadCache(filename string) (c *BuildCache)
+		guids.loadGUIDs(filename string, feedFile string) (r *GUIDRegistry)
 		getTracksFilename(yamlFile string) (tracksFile string)
-		processTracks(fp fpodcast.Podcast, tracksFile string) (tracks []*Track)
-			readCSV(csvFile string) (tracks []*Track)
-			readTXT(txtFile string) (tracks []*Track)
-			readXLS(xlsFile string) (tracks []*Track)
-			preProcessTrack(trackIndex int, track *Track, lastTrack *Track) bool
+		processTracks(fp *fpodcast.Podcast, tracksFile string) (tracks []*Track)
+			readTracks(tracksFile string) (tracks []*Track)
+				readCSV(csvFile string) (tracks []*Track)
+				readTXT(txtFile string) (tracks []*Track)
+				readXLS(xlsFile string) (tracks []*Track)
+			preProcessTrack(fp *fpodcast.Podcast, trackIndex int, track *Track, lastTrack *Track) bool
+				template.applyEarlyTemplates(fp *fpodcast.Podcast, track *Track)
 				setTrackDefaults(track *Track, lastTrack *Track) bool
+					transcode.transcodeTrack(track *Track)
+						transcode.transcodedName(filename string, ext string) string
+						transcode.encode(ffmpeg string, src string, dst string, t *Transcode) error
+							transcode.encodeArgs(src string, t *Transcode, stats *loudnormStats) []string
+					existing.fillFromTags(track *Track) map[string]string (prefer_existing_tags only)
+						existing.existingTags(filename string) (map[string]string, error)
 					setCopyright(track *Track, copyright string, copyrightMask string, year int)
-					utils.getDurationViaExiftool(filename string, exiftool string) (durationMilliseconds int64, err error)
-					utils.getDurationViaFfmpeg(filename string, ffmpeg string) (durationMilliseconds int64, err error)
-					utils.getDurationViaFfprobe(filename string, ffprobe string) (durationMilliseconds int64, err error)
+					cache.Lookup(track *Track) *CacheEntry
+					utils.getEnclosureType(filename string) fpodcast.EnclosureType
+					getDuration(filename string, enclosureType fpodcast.EnclosureType) (durationMilliseconds int64, err error)
+						mp4.getDurationViaMP4(filename string) (durationMilliseconds int64, err error)
+						mp3.getDurationViaMP3(filename string) (durationMilliseconds int64, err error)
+							mp3.getDurationViaTLEN(filename string) (durationMilliseconds int64, err error)
+						utils.getDurationViaExiftool(filename string, exiftool string) (durationMilliseconds int64, err error)
+						utils.getDurationViaFfmpeg(filename string, ffmpeg string) (durationMilliseconds int64, err error)
+						utils.getDurationViaFfprobe(filename string, ffprobe string) (durationMilliseconds int64, err error)
+					artwork.setTrackImage(track *Track)
+					chapters.setTrackChapters(track *Track)
+						chapters.parseChapters(s string) (chapters []Chapter, err error)
+					transcript.setTrackTranscripts(track *Track)
+						transcript.readTranscript(filename string) (*Transcript, error)
+			template.applyPodcastTemplates(fp *fpodcast.Podcast, tracks []*Track)
+				template.setTemplates(v reflect.Value, name string, data map[string]interface{})
+			template.applyTemplates(fp *fpodcast.Podcast, tracks []*Track)
+				template.executeTemplate(name string, text string, data map[string]interface{}) (string, error)
 			processTrack(trackIndex int, track *Track, lastTrack *Track, tracks []*Track)
-				setTags(tag *id3v2.Tag, track *Track, tracks []*Track)
-					totalDiscs(tracks []*Track) (totalDiscs int)
-					totalTracks(tracks []*Track, discNumber string) (totalTracks int)
-					addTextFrame(tag *id3v2.Tag, id string, text string)
-					addFrontCover(filename string) (pic *id3v2.PictureFrame, err error)
-		savePodcast(fp fpodcast.Podcast, tracks []*Track)
+				plan.planTrack(track *Track, tracks []*Track) (dry-run only)
+				cache.tagFingerprint(track *Track, tracks []*Track) string
+				cache.Current(track *Track, fingerprint string) *CacheEntry
+				copyTrack(track *Track) (newPath string)
+					track.NewName(renameMask string) (newTrackName string, err error)
+				tagMP3(filename string, track *Track, tracks []*Track)
+					setTags(tag *id3v2.Tag, track *Track, tracks []*Track)
+						totalDiscs(tracks []*Track) (totalDiscs int)
+						totalTracks(tracks []*Track, discNumber string) (totalTracks int)
+						addTextFrame(tag *id3v2.Tag, id string, text string)
+						transcript.addTranscriptFrames(tag *id3v2.Tag, track *Track)
+						frontCover(track *Track) (pic *id3v2.PictureFrame, err error)
+							addFrontCover(filename string) (pic *id3v2.PictureFrame, err error)
+					chapters.saveTag(tag *id3v2.Tag, filename string, track *Track) error
+						chapters.chapterFrames(track *Track, version byte) []byte
+				tagMP4(filename string, track *Track, tracks []*Track)
+					setMP4Tags(f *MP4File, track *Track, tracks []*Track)
+				cache.Update(track *Track, fingerprint string)
+		buildPodcast(fp *fpodcast.Podcast, tracks []*Track) *fpodcast.Podcast
 			createdDate(tracks []*Track) (createdDate time.Time)
 			updatedDate(tracks []*Track) (updatedDate time.Time)
-			setPodcast(p *podcast.Podcast, fp *fpodcast.Podcast)
-			addTrack(p *podcast.Podcast, track *Track)
-				track.NewName(renameMask string) (newTrackName string, err error)
-				copyImage(fp *fpodcast.Podcast, outputDir string)
+			setPodcast(p *fpodcast.Podcast, fp *fpodcast.Podcast)
+			addTrack(p *fpodcast.Podcast, track *Track)
+				track.NewName(renameMask string) (newTrackName string, err error) (tag_in_place only)
+				guids.GUID(track *Track, enclosureURL string) string
+		validation.Podcast(p *fpodcast.Podcast, imageDir string, mediaDir string) (validate only)
+		savePodcast(p *fpodcast.Podcast, fp *fpodcast.Podcast, tracks []*Track)
+			copyImage(fp *fpodcast.Podcast, outputDir string)
+			artwork.copyEpisodeImages(tracks []*Track, outputDir string)
+			chapters.writeChapters(tracks []*Track, outputDir string)
+			transcript.writeTranscripts(tracks []*Track, outputDir string)
+			site.writeSite(p *fpodcast.Podcast, tracks []*Track, outputDir string) (site only)
+				writeFeed(filename string, encode func(w io.Writer) error)
+			writeFeed(filename string, encode func(w io.Writer) error)
+				fpodcast.Encode(w io.Writer) error
+				fpodcast.EncodeAtom(w io.Writer, selfURL string) error (atom_file only)
+				fpodcast.EncodeJSON(w io.Writer, feedURL string) error (json_file only)
+				plan.planFeed(filename string, data []byte) (dry-run only)
 			validTracks(tracks []*Track) (rv uint)
+		cache.Save()
+		guids.Save()
 */
 
 /*
@@ -191,15 +345,35 @@ func setTrackDefaults(track *Track, lastTrack *Track) bool {
 		return false
 	}
 
+	transcodeTrack(track)
+
+	var filled map[string]string
+	if defaults.preferTags {
+		filled = fillFromTags(track)
+	}
+
+	// the *_template settings are evaluated by applyTemplates
+	if track.Title == "" {
+		track.Title = defaults.TitleTemplate
+	}
 	if track.Title == "" {
 		if track.Filename != "" {
 			track.Title = basename(path.Base(track.Filename))
 		}
 	}
+	if track.Description == "" {
+		track.Description = defaults.DescriptionTemplate
+	}
 	if track.Description == "" {
 		// per https://github.com/eduncan911/podcast/blob/master/podcast.go#L270
 		track.Description = track.Title
 	}
+	if track.Subtitle == "" {
+		track.Subtitle = defaults.SubtitleTemplate
+	}
+	if track.Summary == "" {
+		track.Summary = defaults.SummaryTemplate
+	}
 
 	if lastTrack != nil {
 		track.Artist = lastTrack.Artist
@@ -219,7 +393,16 @@ func setTrackDefaults(track *Track, lastTrack *Track) bool {
 	track.OriginalFileSize = fi.Size()
 	track.FileSize = fi.Size()
 
-	year := fi.ModTime().Year()
+	if track.PubDate != "" {
+		pubDate, err := parsePubDate(track.PubDate, defaults.location)
+		if err != nil {
+			log.Warnf("%q: %s, using the file's modification time", track.Filename, err)
+		} else {
+			track.ModTime = pubDate.UnixNano()
+		}
+	}
+
+	year := time.Unix(0, track.ModTime).In(defaults.location).Year()
 	if track.Year != "" {
 		y, err := strconv.Atoi(track.Year)
 		if err == nil {
@@ -231,19 +414,22 @@ func setTrackDefaults(track *Track, lastTrack *Track) bool {
 
 	track.SetCopyright(defaults.Copyright, defaults.CopyrightMask, year)
 
-	track.DurationMilliseconds, err = getDurationViaExiftool(track.Filename, defaults.Exiftool)
-	var err2 error
-	if err != nil {
-		track.DurationMilliseconds, err2 = getDurationViaFfprobe(track.Filename, defaults.Ffprobe)
-	}
-	var err3 error
-	if err2 != nil {
-		track.DurationMilliseconds, err3 = getDurationViaFfmpeg(track.Filename, defaults.Ffmpeg)
-	}
-	if err3 != nil {
-		log.Warnf(err.Error())
-		log.Warnf(err2.Error())
-		log.Warnf(err3.Error())
+	if entry := cache.Lookup(track); entry != nil {
+		log.Debugf("Using cached duration for %q", track.Filename)
+		track.EnclosureType = entry.EnclosureType
+		track.DurationMilliseconds = entry.DurationMilliseconds
+	} else {
+		track.EnclosureType = getEnclosureType(track.Filename)
+		track.DurationMilliseconds, err = getDuration(track.Filename, track.EnclosureType)
+		if err != nil && track.Length != "" {
+			log.Debug(err)
+			track.DurationMilliseconds, err = parseLength(track.Length)
+			if err != nil {
+				log.Warnf("%q: %s", track.Filename, err)
+			}
+		} else if err != nil {
+			log.Warn(err)
+		}
 	}
 
 	if track.Track == "" {
@@ -270,14 +456,58 @@ func setTrackDefaults(track *Track, lastTrack *Track) bool {
 		}
 	}
 
+	// the file's tags take precedence over the previous row's
+	for field, value := range filled {
+		track.Set(field, value)
+	}
+
 	if track.DiscNumber == "" {
 		track.DiscNumber = defaults.DiscNumber
 	}
 
+	track.SetSeasonEpisode(defaults.autoSeason)
+	setTrackImage(track)
+	setTrackChapters(track)
+	setTrackTranscripts(track)
+
 	track.Processed = true
 	return true
 }
 
+// getDuration returns the duration of filename, using the built-in parsers,
+// and, if duration_tools is true, exiftool, ffprobe and ffmpeg, in that order
+func getDuration(filename string, enclosureType fpodcast.EnclosureType) (durationMilliseconds int64, err error) {
+	switch {
+	case isMP4(enclosureType):
+		durationMilliseconds, err = getDurationViaMP4(filename)
+	case enclosureType == fpodcast.AAC:
+		err = fmt.Errorf("%q: no built-in parser for raw AAC files (set duration_tools to true)", filename)
+	default:
+		durationMilliseconds, err = getDurationViaMP3(filename)
+	}
+	if err == nil {
+		return durationMilliseconds, nil
+	}
+	if !defaults.durationTools {
+		return 0, err
+	}
+	log.Debug(err)
+
+	durationMilliseconds, err = getDurationViaExiftool(filename, defaults.Exiftool)
+	if err == nil {
+		return durationMilliseconds, nil
+	}
+	log.Debug(err)
+
+	durationMilliseconds, err = getDurationViaFfprobe(filename, defaults.Ffprobe)
+	if err == nil {
+		return durationMilliseconds, nil
+	}
+	log.Debug(err)
+
+	return getDurationViaFfmpeg(filename, defaults.Ffmpeg)
+}
+
 func totalDiscs(tracks []*Track) (totalDiscs int) {
 	totalDiscs = 0
 	for _, track := range tracks {
@@ -382,7 +612,7 @@ func setTags(tag *id3v2.Tag, track *Track, tracks []*Track) {
 
 	// system defined fields:
 
-	modTime := time.Unix(0, track.ModTime)
+	modTime := time.Unix(0, track.ModTime).In(defaults.location)
 	mmdd := fmt.Sprintf("%02d%02d", modTime.Month(), modTime.Day())
 	hhmm := fmt.Sprintf("%02d%02d", modTime.Hour(), modTime.Minute())
 
@@ -404,16 +634,105 @@ func setTags(tag *id3v2.Tag, track *Track, tracks []*Track) {
 	}
 	tag.AddCommentFrame(comment)
 
+	addTranscriptFrames(tag, track)
+
+	// saveTag adds the new chapters
+	if len(track.ChapterList) > 0 {
+		tag.DeleteFrames("CTOC")
+		tag.DeleteFrames("CHAP")
+	}
+
 	if defaults.Image == "" {
 		return
 	}
 
-	pic, err := addFrontCover(defaults.Image)
+	pic, err := frontCover(track)
 	if err == nil && pic != nil {
 		tag.AddAttachedPicture(*pic)
 	}
 }
 
+func setMP4Tags(f *MP4File, track *Track, tracks []*Track) {
+	discNumber, _ := strconv.Atoi(track.DiscNumber)
+	totalDiscs := totalDiscs(tracks)
+	if !defaults.totalDiscs {
+		totalDiscs = 0
+	}
+
+	trackNumber, _ := strconv.Atoi(track.Track)
+	totalTracks := totalTracks(tracks, track.DiscNumber)
+	if !defaults.totalTracks {
+		totalTracks = 0
+	}
+
+	f.SetText(mp4Album, track.AlbumTitle)
+	f.SetText(mp4AlbumArtist, track.AlbumArtist)
+	f.SetText(mp4Artist, track.Artist)
+	f.SetText(mp4Composer, track.Composer)
+	f.SetText(mp4Copyright, track.Copyright)
+	f.SetText(mp4Genre, track.Genre)
+	f.SetText(mp4Title, track.Title)
+	f.SetText(mp4Year, track.Year)
+	f.SetNumber(mp4Disc, discNumber, totalDiscs)
+	f.SetNumber(mp4Track, trackNumber, totalTracks)
+	f.SetText(mp4EncodedBy, defaults.EncodedBy)
+
+	description := track.Description
+	if track.Subtitle != "" {
+		if description != "" {
+			description += " / "
+		}
+		description += track.Subtitle
+	}
+	f.SetText(mp4Description, description)
+
+	if text := transcriptText(track); text != "" {
+		f.SetText(mp4Lyrics, text)
+	}
+
+	if len(track.ChapterList) > 0 {
+		log.Debugf("Not adding chapters to %q, only the JSON chapters file", track.Filename)
+	}
+
+	if defaults.Image == "" {
+		return
+	}
+
+	pic, err := frontCover(track)
+	if err == nil && pic != nil {
+		f.SetCover(pic.MimeType, pic.Picture)
+	}
+}
+
+// frontCover returns the track's artwork, or else the podcast's conformed
+// artwork, or, if image_conform is false, its image file, as an APIC frame
+func frontCover(track *Track) (pic *id3v2.PictureFrame, err error) {
+	art := trackArtwork(track)
+	if art == nil {
+		art = defaults.artwork
+	}
+	if art == nil {
+		return addFrontCover(defaults.Image)
+	}
+	pic = &id3v2.PictureFrame{
+		Encoding:    id3v2.EncodingUTF8,
+		MimeType:    art.MimeType,
+		PictureType: id3v2.PTFrontCover,
+		Description: "Front cover",
+		Picture:     art.Data,
+	}
+	return pic, nil
+}
+
+// showImageName returns the name of the show's image in output_dir: the
+// conformed artwork, or, if image_conform is false, the image file
+func showImageName() string {
+	if defaults.artwork != nil {
+		return defaults.artwork.Name
+	}
+	return path.Base(defaults.Image)
+}
+
 func addFrontCover(filename string) (pic *id3v2.PictureFrame, err error) {
 	log.Debugf("Reading %q", filename)
 	_, err = os.Stat(filename)
@@ -446,10 +765,9 @@ func addFrontCover(filename string) (pic *id3v2.PictureFrame, err error) {
 	return pic, nil
 }
 
-func preProcessTrack(trackIndex int, track *Track, lastTrack *Track) bool {
+func preProcessTrack(fp *fpodcast.Podcast, trackIndex int, track *Track, lastTrack *Track) bool {
 	if track.Filename != "" {
 		log.Infof("Preprocessing row %2d: %q", trackIndex, track.Filename)
-		track.NormalizeFilename()
 	}
 
 	if !track.IsValid() {
@@ -457,6 +775,9 @@ func preProcessTrack(trackIndex int, track *Track, lastTrack *Track) bool {
 		return false
 	}
 
+	applyEarlyTemplates(fp, track)
+	track.NormalizeFilename()
+
 	setTrackDefaults(track, lastTrack)
 
 	if !track.IsValid() {
@@ -467,40 +788,129 @@ func preProcessTrack(trackIndex int, track *Track, lastTrack *Track) bool {
 	return true
 }
 
-func processTrack(trackIndex int, track *Track, lastTrack *Track, tracks []*Track) {
-	log.Infof("Processing track %2d: %q", trackIndex, track.Filename)
-
-	tag, err := id3v2.Open(track.Filename, id3v2.Options{Parse: true})
+func tagMP3(filename string, track *Track, tracks []*Track) {
+	tag, err := id3v2.Open(filename, id3v2.Options{Parse: true})
 	if err != nil {
-		log.Fatalf("Cannot open %q: %s", track.Filename, err)
+		log.Fatalf("Cannot open %q: %s", filename, err)
 	}
 
 	setTags(tag, track, tracks)
 
 	// Write it to file.
-	err = tag.Save()
+	err = saveTag(tag, filename, track)
+	if err != nil {
+		log.Fatalf("Cannot save tags for %q: %s", filename, err)
+	}
+}
+
+func tagMP4(filename string, track *Track, tracks []*Track) {
+	f, err := OpenMP4(filename)
+	if err != nil {
+		log.Fatalf("Cannot open %q: %s", filename, err)
+	}
+
+	setMP4Tags(f, track, tracks)
+
+	err = f.Save()
+	if err != nil {
+		log.Fatalf("Cannot save tags for %q: %s", filename, err)
+	}
+}
+
+// outputName returns the track's name in output_dir: its name per rename_mask,
+// or else its filename, less its directory, if any
+func outputName(track *Track) string {
+	newTrackName, err := track.NewName(defaults.RenameMask)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if newTrackName == "" || newTrackName == track.Filename {
+		newTrackName = path.Base(filepath.ToSlash(track.Filename))
+	}
+	return newTrackName
+}
+
+// copyToOutput copies the track to newTrackName in output_dir, keeping its
+// modification time, and returns the copy's path
+func copyToOutput(track *Track, newTrackName string) (newPath string) {
+	newPath = defaults.OutputDir + newTrackName
+	log.Infof("Copying %q to %q", track.Filename, newPath)
+	err := copyFile(track.Filename, newPath)
+	if err != nil {
+		log.Fatalf("Cannot copy %q to %q: %s", track.Filename, newPath, err)
+	}
+	modTime := time.Unix(0, track.OriginalModTime)
+	log.Debugf("Setting time for %q to %v", newPath, modTime)
+	err = os.Chtimes(newPath, modTime, modTime)
 	if err != nil {
-		log.Fatalf("Cannot save tags for %q: %s", track.Filename, err)
+		log.Warnf("Cannot set time for %q: %s", newPath, err)
 	}
-	tag.Close()
+	return newPath
+}
+
+// copyTrack copies the track into the output directory, renaming it per
+// rename_mask, so the copy can be tagged instead of the original
+func copyTrack(track *Track) (newPath string) {
+	newTrackName := outputName(track)
+	newPath = copyToOutput(track, newTrackName)
+	track.OutputName = newTrackName
+	return newPath
+}
+
+func processTrack(trackIndex int, track *Track, lastTrack *Track, tracks []*Track) {
+	log.Infof("Processing track %2d: %q", trackIndex, track.Filename)
+
+	if dryRun {
+		planTrack(track, tracks)
+		return
+	}
+
+	fingerprint := tagFingerprint(track, tracks)
+	if entry := cache.Current(track, fingerprint); entry != nil {
+		log.Infof("Skipping track %2d: %q is unchanged", trackIndex, track.Filename)
+		if entry.OutputName != "" {
+			track.OutputName = entry.OutputName
+			track.FileSize = entry.OutputSize
+		} else {
+			track.FileSize = entry.Size
+		}
+		return
+	}
+
+	filename := track.Filename
+	if !defaults.tagInPlace {
+		filename = copyTrack(track)
+	}
+
+	switch {
+	case isMP4(track.EnclosureType):
+		tagMP4(filename, track, tracks)
+	case track.EnclosureType == fpodcast.AAC:
+		log.Warnf("Not tagging %q: raw AAC files have no tags, and Apple Podcasts does not support them (use .m4a files)", filename)
+	default:
+		tagMP3(filename, track, tracks)
+	}
+
 	if track.OriginalModTime != 0 {
 		modTime := time.Unix(0, track.OriginalModTime)
-		err = os.Chtimes(track.Filename, modTime, modTime)
+		err := os.Chtimes(filename, modTime, modTime)
 		if err != nil {
-			log.Warnf("Cannot set time for %q: %s", track.Filename, err)
+			log.Warnf("Cannot set time for %q: %s", filename, err)
 		}
 	}
 
-	fi, err := os.Stat(track.Filename)
+	fi, err := os.Stat(filename)
 	if err != nil {
-		log.Fatalf("Cannot open %q: %s", track.Filename, err)
+		log.Fatalf("Cannot open %q: %s", filename, err)
 	}
 	track.FileSize = fi.Size()
+
+	cache.Update(track, fingerprint)
 }
 
 func setDefaults(fp *fpodcast.Podcast) {
 	fp.IAuthor = defaults.Author
-	fp.Category = defaults.Category
+	fp.ICategories = defaults.Category.ICategories()
 	fp.IComplete = defaults.Complete
 	fp.Copyright = defaults.Copyright
 	fp.IExplicit = defaults.Explicit
@@ -515,20 +925,16 @@ func setDefaults(fp *fpodcast.Podcast) {
 	fp.IOwner = &fpodcast.Author{Name: defaults.Author, Email: defaults.Email}
 }
 
-func setPodcast(p *podcast.Podcast, fp *fpodcast.Podcast) {
+func setPodcast(p *fpodcast.Podcast, fp *fpodcast.Podcast) {
 	p.Title = fp.Title
 	p.Link = fp.Link
+	if p.Link == "" && defaults.site {
+		// the site is the podcast's web site
+		p.Link = defaults.BaseURL
+	}
 	p.Description = fp.Description
 
-	// p.Category = fp.Category
-	re := regexp.MustCompile(`^([^,]*),(.*)$`)
-	b := re.FindStringSubmatch(fp.Category)
-	var subCategories []string
-	if len(b) > 0 {
-		fp.Category = b[1]
-		subCategories = append(subCategories, b[2])
-	}
-	p.AddCategory(fp.Category, subCategories)
+	addCategories(p, fp.ICategories)
 
 	p.Cloud = fp.Cloud
 	p.Copyright = fp.Copyright
@@ -583,21 +989,84 @@ func setPodcast(p *podcast.Podcast, fp *fpodcast.Podcast) {
 	}
 
 	if fp.IOwner != nil {
-		p.IOwner = &podcast.Author{Name: fp.IOwner.Name, Email: fp.IOwner.Email}
+		p.IOwner = &fpodcast.Author{Name: fp.IOwner.Name, Email: fp.IOwner.Email}
+	}
+
+	// podcast:guid is a UUIDv5 of the feed's URL, unless overridden by pguid
+	if fp.PGUID != "" {
+		p.PGUID = fp.PGUID
+	} else if defaults.BaseURL != "" {
+		p.AddPodcastGUID(defaults.BaseURL + path.Base(defaults.OutputFile))
+		p.PGUID = guids.FeedGUID(p.PGUID)
+	}
+
+	if fp.PLocked != nil && fp.PLocked.Text != "" {
+		p.PLocked = &fpodcast.PLocked{Owner: fp.PLocked.Owner, Text: fp.PLocked.Text}
+		if p.PLocked.Owner == "" && fp.IOwner != nil {
+			p.PLocked.Owner = fp.IOwner.Email
+		}
+	}
+
+	for _, funding := range fp.PFunding {
+		if funding != nil {
+			p.AddFunding(funding.URL, funding.Text)
+		}
+	}
+
+	if fp.PLicense != nil && fp.PLicense.Text != "" {
+		p.PLicense = &fpodcast.PLicense{URL: fp.PLicense.URL, Text: fp.PLicense.Text}
 	}
+
+	if fp.PLocation != nil && fp.PLocation.Text != "" {
+		p.PLocation = &fpodcast.PLocation{Geo: fp.PLocation.Geo, OSM: fp.PLocation.OSM, Text: fp.PLocation.Text}
+	}
+}
+
+// addPodcastTags adds the track's podcast namespace (Podcasting 2.0) tags to item
+func addPodcastTags(item *fpodcast.Item, track *Track) {
+	if len(track.Transcripts) > 0 {
+		for _, f := range transcriptFiles(track) {
+			item.AddTranscript(defaults.BaseURL+f.Name, transcriptType(f.Name), defaults.Language)
+		}
+	} else if track.Transcript != "" {
+		item.AddTranscript(absoluteURL(track.Transcript), transcriptType(track.Transcript), defaults.Language)
+	}
+	if len(track.ChapterList) > 0 {
+		item.AddChapters(defaults.BaseURL + chaptersName(track))
+	} else if strings.Contains(track.Chapters, "://") || strings.EqualFold(path.Ext(track.Chapters), ".json") {
+		// a chapters file, not chapters that could not be read
+		item.AddChapters(absoluteURL(track.Chapters))
+	}
+
+	// "Jane Doe (host); John Doe (guest)"
+	re := regexp.MustCompile(`^\s*(.*?)\s*(?:\(\s*([^)]*?)\s*\))?\s*$`)
+	for _, person := range strings.Split(track.Person, ";") {
+		b := re.FindStringSubmatch(person)
+		if len(b) > 0 && b[1] != "" {
+			item.AddPerson(b[1], strings.ToLower(b[2]))
+		}
+	}
+
+	// SetSeasonEpisode has already validated these
+	season, _ := strconv.Atoi(track.Season)
+	item.AddSeason(season, "")
+	item.AddEpisode(track.Episode)
 }
 
-func addTrack(p *podcast.Podcast, track *Track) {
+func addTrack(p *fpodcast.Podcast, track *Track) {
 	log.Debugf("Adding track %q", track.Filename)
-	pubDate := time.Unix(0, track.ModTime)
-	item := podcast.Item{
+	pubDate := time.Unix(0, track.ModTime).In(defaults.location)
+	item := fpodcast.Item{
 		Title:       track.Title,
 		Description: track.Description,
 		ISubtitle:   track.Subtitle,
 		PubDate:     &pubDate,
 	}
-	// @TODO(rasa) change to p.Image.URL
-	item.AddImage(defaults.BaseURL + defaults.Image)
+	if art := trackArtwork(track); art != nil {
+		item.AddImage(defaults.BaseURL + art.Name)
+	} else {
+		item.AddImage(defaults.BaseURL + showImageName())
+	}
 	if track.DurationMilliseconds > 0 {
 		item.IDuration = track.Duration()
 	}
@@ -605,35 +1074,46 @@ func addTrack(p *podcast.Podcast, track *Track) {
 		item.AddSummary(track.Summary)
 	}
 
-	newTrackName, err := track.NewName(defaults.RenameMask)
-	if err != nil {
-		log.Fatal(err)
-	}
-	if newTrackName != "" {
-		if !strings.EqualFold(track.Filename, newTrackName) {
-			newPath := defaults.OutputDir + newTrackName
-			log.Infof("Copying %q to %q", track.Filename, newPath)
-			err = copyFile(track.Filename, newPath)
-			if err != nil {
-				log.Fatalf("Cannot copy %q to %q: %s", track.Filename, newPath, err)
-
-			}
-			modTime := time.Unix(0, track.ModTime)
-			log.Debugf("Setting time for %q to %v", newPath, modTime)
-			err = os.Chtimes(newPath, modTime, modTime)
-			if err != nil {
-				log.Warnf("Cannot set time for %q: %s", newPath, err)
-			}
-
-			track.Filename = newTrackName
+	// itunes:title is the episode's title, without season or episode numbers
+	item.ITitle = track.Title
+	item.ISeason = track.Season
+	// itunes:episode must be an integer
+	if _, err := strconv.Atoi(track.Episode); err == nil {
+		item.IEpisode = track.Episode
+	}
+	item.IEpisodeType = track.EpisodeType
+
+	if track.OutputName == "" {
+		// tag_in_place: the track was tagged, but is only copied if it is
+		// renamed, or is in another directory
+		newTrackName := outputName(track)
+		newPath := defaults.OutputDir + newTrackName
+		switch {
+		case strings.EqualFold(track.Filename, newTrackName):
+			newTrackName = track.Filename
+		case upToDate(track.Filename, newPath):
+			log.Debugf("%q is up to date", newPath)
+		case dryRun:
+			planRename(track.Filename, newTrackName)
+			planCopy(track.Filename, newPath)
+		default:
+			copyToOutput(track, newTrackName)
 		}
+		track.Filename = newTrackName
+		track.OutputName = track.Filename
 	}
 
 	// add a Download to the Item
-	item.AddEnclosure(defaults.BaseURL+track.Filename, podcast.MP3, track.FileSize)
+	enclosureURL := defaults.BaseURL + track.OutputName
+	item.AddEnclosure(enclosureURL, track.EnclosureType, track.FileSize)
+	item.GUID = guids.GUID(track, enclosureURL)
+	if defaults.site {
+		item.Link = defaults.BaseURL + sitePageName(track)
+	}
+	addPodcastTags(&item, track)
 
 	// add the Item and check for validation errors
-	_, err = p.AddItem(item)
+	_, err := p.AddItem(item)
 	if err != nil {
 		log.Fatalf("Cannot add track %q: %s", track.Filename, err)
 	}
@@ -660,6 +1140,21 @@ func processImage(fp *fpodcast.Podcast, imageName string, baseURL string) (err e
 
 	basename := path.Base(fp.Image.URL)
 	log.Debugf("Processing image %q", basename)
+
+	defaults.artwork = nil
+	if defaults.imageConform {
+		art, err := conformImage(basename)
+		if err != nil {
+			log.Warnf("Cannot read %q: %s", basename, err)
+			return err
+		}
+		defaults.artwork = art
+		fp.Image.URL = strings.TrimSuffix(fp.Image.URL, basename) + art.Name
+		fp.Image.Width = art.Width
+		fp.Image.Height = art.Height
+		return nil
+	}
+
 	reader, err := os.Open(basename)
 	if err != nil {
 		log.Warnf("Cannot open %q: %s", basename, err)
@@ -699,6 +1194,22 @@ func processImage(fp *fpodcast.Podcast, imageName string, baseURL string) (err e
 func copyImage(fp *fpodcast.Podcast, outputDir string) {
 	basename := path.Base(fp.Image.URL)
 	newPath := outputDir + basename
+	if defaults.artwork != nil {
+		if dryRun {
+			planCopy(defaults.Image, newPath)
+			return
+		}
+		log.Infof("Saving %q to %q", defaults.Image, newPath)
+		err := ioutil.WriteFile(newPath, defaults.artwork.Data, 0644)
+		if err != nil {
+			log.Fatalf("Cannot write %q: %s", newPath, err)
+		}
+		return
+	}
+	if dryRun {
+		planCopy(basename, newPath)
+		return
+	}
 	log.Infof("Copying %q to %q", basename, newPath)
 	err := copyFile(basename, newPath)
 	if err != nil {
@@ -777,10 +1288,7 @@ func readXLS(xlsFile string) (tracks []*Track) {
 
 	nameToColMap := make(map[int]string)
 
-	rows, err := xlsx.GetRows(sheetName)
-	if err != nil {
-		log.Fatalf("Cannot get rows for sheet %q in %q: %s", sheetName, xlsFile, err)
-	}
+	rows := xlsx.GetRows(sheetName)
 	for i, row := range rows {
 		if i == 0 {
 			for j, colCell := range row {
@@ -819,7 +1327,7 @@ func createdDate(tracks []*Track) (createdDate time.Time) {
 			continue
 		}
 
-		modTime := time.Unix(0, track.ModTime)
+		modTime := time.Unix(0, track.ModTime).In(defaults.location)
 		if createdDate.After(modTime) {
 			createdDate = modTime
 		}
@@ -834,7 +1342,7 @@ func updatedDate(tracks []*Track) (updatedDate time.Time) {
 			continue
 		}
 
-		modTime := time.Unix(0, track.ModTime)
+		modTime := time.Unix(0, track.ModTime).In(defaults.location)
 		if updatedDate.Before(modTime) {
 			updatedDate = modTime
 		}
@@ -874,8 +1382,13 @@ func loadDefaults(yamlFile string, genFilenames bool) {
 	fi, err := os.Stat(defaults.OutputDir)
 	if err != nil {
 		if os.IsNotExist(err) {
-			log.Debugf("Creating directory %q", defaults.OutputDir)
-			err = os.MkdirAll(defaults.OutputDir, os.ModePerm)
+			if dryRun {
+				planMkdir(defaults.OutputDir)
+				err = nil
+			} else {
+				log.Debugf("Creating directory %q", defaults.OutputDir)
+				err = os.MkdirAll(defaults.OutputDir, os.ModePerm)
+			}
 		}
 		if err != nil {
 			log.Fatalf("Cannot create directory %q: %s", defaults.OutputDir, err)
@@ -903,6 +1416,30 @@ func loadDefaults(yamlFile string, genFilenames bool) {
 		}
 	}
 
+	defaults.autoSeason, err = strconv.ParseBool(defaults.AutoSeason)
+	if err != nil {
+		log.Fatalf("Cannot parse auto_season in %q: %s", defaults.PodcastFile, err)
+	}
+	defaults.cache, err = strconv.ParseBool(defaults.Cache)
+	if err != nil {
+		log.Fatalf("Cannot parse cache in %q: %s", defaults.PodcastFile, err)
+	}
+	defaults.durationTools, err = strconv.ParseBool(defaults.DurationTools)
+	if err != nil {
+		log.Fatalf("Cannot parse duration_tools in %q: %s", defaults.PodcastFile, err)
+	}
+	defaults.preferTags, err = strconv.ParseBool(defaults.PreferTags)
+	if err != nil {
+		log.Fatalf("Cannot parse prefer_existing_tags in %q: %s", defaults.PodcastFile, err)
+	}
+	defaults.site, err = strconv.ParseBool(defaults.Site)
+	if err != nil {
+		log.Fatalf("Cannot parse site in %q: %s", defaults.PodcastFile, err)
+	}
+	defaults.tagInPlace, err = strconv.ParseBool(defaults.TagInPlace)
+	if err != nil {
+		log.Fatalf("Cannot parse tag_in_place in %q: %s", defaults.PodcastFile, err)
+	}
 	defaults.totalDiscs, err = strconv.ParseBool(defaults.TotalDiscs)
 	if err != nil {
 		log.Fatalf("Cannot parse total_discs in %q: %s", defaults.PodcastFile, err)
@@ -911,22 +1448,92 @@ func loadDefaults(yamlFile string, genFilenames bool) {
 	if err != nil {
 		log.Fatalf("Cannot parse total_tracks in %q: %s", defaults.PodcastFile, err)
 	}
+	defaults.imageConform, err = strconv.ParseBool(defaults.ImageConform)
+	if err != nil {
+		log.Fatalf("Cannot parse image_conform in %q: %s", defaults.PodcastFile, err)
+	}
+	if defaults.ImageFit != "crop" && defaults.ImageFit != "pad" {
+		log.Fatalf("Cannot parse image_fit in %q: %q is not crop or pad", defaults.PodcastFile, defaults.ImageFit)
+	}
+	defaults.imagePadColor, err = parseColor(defaults.ImagePadColor)
+	if err != nil {
+		log.Fatalf("Cannot parse image_pad_color in %q: %s", defaults.PodcastFile, err)
+	}
+	defaults.imageSizeMax, err = parseSize(defaults.ImageSizeMax)
+	if err != nil {
+		log.Fatalf("Cannot parse image_size_max in %q: %s", defaults.PodcastFile, err)
+	}
+	defaults.captions, err = parseCaptionFormats(defaults.Captions)
+	if err != nil {
+		log.Fatalf("Cannot parse captions in %q: %s", defaults.PodcastFile, err)
+	}
+	defaults.transcriptSYLT, err = strconv.ParseBool(defaults.TranscriptSYLT)
+	if err != nil {
+		log.Fatalf("Cannot parse transcript_sylt in %q: %s", defaults.PodcastFile, err)
+	}
+	defaults.Publish.pathStyle, err = strconv.ParseBool(defaults.Publish.PathStyle)
+	if err != nil {
+		log.Fatalf("Cannot parse publish path_style in %q: %s", defaults.PodcastFile, err)
+	}
+	err = defaults.Transcode.parse()
+	if err != nil {
+		log.Fatalf("Cannot parse transcode in %q: %s", defaults.PodcastFile, err)
+	}
+	defaults.location, err = time.LoadLocation(defaults.Timezone)
+	if err != nil {
+		log.Fatalf("Cannot parse timezone in %q: %s", defaults.PodcastFile, err)
+	}
 
 	defaults.Exiftool = normalizeDirectory(defaults.Exiftool)
+	defaults.GUIDFile = normalizeDirectory(defaults.GUIDFile)
 	defaults.Ffmpeg = normalizeDirectory(defaults.Ffmpeg)
 	defaults.Ffprobe = normalizeDirectory(defaults.Ffprobe)
 	defaults.Image = normalizeDirectory(defaults.Image)
 	defaults.OutputDir = normalizeDirectory(defaults.OutputDir)
 	defaults.OutputFile = normalizeDirectory(defaults.OutputFile)
 	defaults.PodcastFile = normalizeDirectory(defaults.PodcastFile)
+	defaults.SiteTemplates = normalizeDirectory(defaults.SiteTemplates)
 	defaults.TracksFile = normalizeDirectory(defaults.TracksFile)
 }
 
+// guidFilename returns guid_file, or, if it is not set, the default
+func guidFilename() string {
+	if defaults.GUIDFile != "" {
+		return defaults.GUIDFile
+	}
+	return fmt.Sprintf(guidsFileMask, basename(defaults.OutputFile))
+}
+
 func processYAML(yamlFile string) {
 	fp := readYAML(yamlFile)
+	cache = nil
+	if defaults.cache {
+		cache = loadCache(defaults.OutputDir + cacheFileName)
+	}
+	guids = loadGUIDs(guidFilename(), defaults.OutputFile)
+	episodeArtwork = make(map[string]*Artwork)
+	transcodes = loadTranscodeCache(defaults.OutputDir + transcodeFileName)
 	tracksFile := getTracksFilename(yamlFile)
-	tracks := processTracks(fp, tracksFile)
-	savePodcast(fp, tracks)
+	tracks := processTracks(&fp, tracksFile)
+	if !dryRun {
+		transcodes.Save()
+	}
+	p := buildPodcast(&fp, tracks)
+	if validation != nil {
+		if defaults.artwork != nil {
+			// the conformed artwork is not saved in a dry run
+			validation.Podcast(p, "", "")
+			validation.imageConfig(defaults.artwork.Name, bytes.NewReader(defaults.artwork.Data))
+			return
+		}
+		validation.Podcast(p, ".", "")
+		return
+	}
+	savePodcast(p, &fp, tracks)
+	if !dryRun {
+		cache.Save()
+		guids.Save()
+	}
 }
 
 func readYAML(yamlFile string) (fp fpodcast.Podcast) {
@@ -934,7 +1541,9 @@ func readYAML(yamlFile string) (fp fpodcast.Podcast) {
 		log.Fatal("Input file name is empty")
 	}
 
-	defaults = initDefaults
+	// a copy, as serve, and multiple .yaml files, read the settings again
+	d := *initDefaults
+	defaults = &d
 
 	yamlFile = normalizeDirectory(yamlFile)
 
@@ -975,6 +1584,18 @@ func readYAML(yamlFile string) (fp fpodcast.Podcast) {
 	if err != nil {
 		log.Fatalf("Cannot process %q: %s", defaults.PodcastFile, err)
 	}
+
+	// category is a list, or a string, so it is read separately
+	var categories struct {
+		Category CategoryList `yaml:"category"`
+	}
+	err = yaml.Unmarshal(yamlData, &categories)
+	if err != nil {
+		log.Fatalf("Cannot process %q: %s", defaults.PodcastFile, err)
+	}
+	if len(categories.Category) > 0 {
+		fp.ICategories = categories.Category.ICategories()
+	}
 	dump("fp@2=", fp)
 
 	// don't exit on image errors
@@ -1007,7 +1628,8 @@ func getTracksFilename(yamlFile string) (tracksFile string) {
 	return
 }
 
-func processTracks(fp fpodcast.Podcast, tracksFile string) (tracks []*Track) {
+// readTracks reads the tracks file, based on its extension
+func readTracks(tracksFile string) (tracks []*Track) {
 	ext := strings.ToLower(filepath.Ext(tracksFile))
 
 	switch ext {
@@ -1020,19 +1642,27 @@ func processTracks(fp fpodcast.Podcast, tracksFile string) (tracks []*Track) {
 	default:
 		log.Fatalf("Unsupported format for tracks file %q: %q", tracksFile, ext)
 	}
+	return tracks
+}
+
+func processTracks(fp *fpodcast.Podcast, tracksFile string) (tracks []*Track) {
+	tracks = readTracks(tracksFile)
 
 	dump("tracks@1=", tracks)
 
 	var lastTrack *Track
 
 	for i, track := range tracks {
-		if preProcessTrack(i+1, track, lastTrack) {
+		if preProcessTrack(fp, i+1, track, lastTrack) {
 			lastTrack = track
 		}
 	}
 	skipped := len(tracks) - int(validTracks(tracks))
 	log.Infof("Preprocessed %d tracks (%d of %d rows were skipped)", validTracks(tracks), skipped, len(tracks))
 
+	applyPodcastTemplates(fp, tracks)
+	applyTemplates(fp, tracks)
+
 	dump("tracks@2=", tracks)
 
 	lastTrack = nil
@@ -1053,21 +1683,15 @@ func processTracks(fp fpodcast.Podcast, tracksFile string) (tracks []*Track) {
 	return
 }
 
-func savePodcast(fp fpodcast.Podcast, tracks []*Track) {
-	log.Infof("Creating %q", defaults.OutputFile)
-	xmlFD, err := os.Create(defaults.OutputFile)
-	if err != nil {
-		log.Fatalf("Cannot create %q: %s", defaults.OutputFile, err)
-	}
-	defer xmlFD.Close()
-
+// buildPodcast returns the podcast for the valid tracks
+func buildPodcast(fp *fpodcast.Podcast, tracks []*Track) *fpodcast.Podcast {
 	// pubDate     := updatedDate.AddDate(0, 0, 3)
 
 	pubDate := createdDate(tracks)
 	lastBuildDate := updatedDate(tracks)
 
 	// instantiate a new Podcast
-	p := podcast.New(
+	p := fpodcast.New(
 		fp.Title,
 		fp.Link,
 		fp.Description,
@@ -1075,7 +1699,7 @@ func savePodcast(fp fpodcast.Podcast, tracks []*Track) {
 		&lastBuildDate,
 	)
 
-	setPodcast(&p, &fp)
+	setPodcast(&p, fp)
 
 	dump("p=", p)
 
@@ -1087,14 +1711,66 @@ func savePodcast(fp fpodcast.Podcast, tracks []*Track) {
 		// d := pubDate.AddDate(0, 0, int(i + 1))
 	}
 
-	copyImage(&fp, defaults.OutputDir)
+	return &p
+}
 
-	// Podcast.Encode writes to an io.Writer
-	err = p.Encode(xmlFD)
+// writeFeed writes the feed encode encodes to filename
+func writeFeed(filename string, encode func(w io.Writer) error) {
+	if dryRun {
+		var buf bytes.Buffer
+		err := encode(&buf)
+		if err != nil {
+			log.Fatalf("Cannot encode %q: %s", filename, err)
+		}
+		planFeed(filename, buf.Bytes())
+		return
+	}
+
+	log.Infof("Creating %q", filename)
+	fd, err := os.Create(filename)
 	if err != nil {
-		log.Fatalf("Cannot write to %q: %s", xmlFD.Name(), err)
+		log.Fatalf("Cannot create %q: %s", filename, err)
+	}
+	defer fd.Close()
+
+	err = encode(fd)
+	if err != nil {
+		log.Fatalf("Cannot write to %q: %s", fd.Name(), err)
+	}
+}
+
+func savePodcast(p *fpodcast.Podcast, fp *fpodcast.Podcast, tracks []*Track) {
+	copyImage(fp, defaults.OutputDir)
+	copyEpisodeImages(tracks, defaults.OutputDir)
+	writeChapters(tracks, defaults.OutputDir)
+	writeTranscripts(tracks, defaults.OutputDir)
+	writeSite(p, tracks, defaults.OutputDir)
+
+	atomURL := ""
+	if defaults.AtomFile != "" {
+		// each feed's self link refers to itself
+		atomURL = defaults.BaseURL + path.Base(defaults.AtomFile)
+		if p.AtomLink == nil || p.AtomLink.HREF == atomURL {
+			p.AddAtomLink(defaults.BaseURL + path.Base(defaults.OutputFile))
+		}
+	}
+
+	// Podcast.Encode writes to an io.Writer
+	writeFeed(defaults.OutputFile, p.Encode)
+	if atomURL != "" {
+		writeFeed(defaults.OutputDir+path.Base(defaults.AtomFile), func(w io.Writer) error {
+			return p.EncodeAtom(w, atomURL)
+		})
+	}
+	if defaults.JSONFile != "" {
+		jsonURL := defaults.BaseURL + path.Base(defaults.JSONFile)
+		writeFeed(defaults.OutputDir+path.Base(defaults.JSONFile), func(w io.Writer) error {
+			return p.EncodeJSON(w, jsonURL)
+		})
+	}
+	if !dryRun {
+		log.Infof("Saved %d tracks to %q", validTracks(tracks), defaults.OutputFile)
 	}
-	log.Infof("Saved %d tracks to %q", validTracks(tracks), defaults.OutputFile)
 }
 
 func main() {
@@ -1111,6 +1787,8 @@ func main() {
 
 	logLevel := flag.Int("log", int(defaultLogLevel), "set log verbosity\n(6=trace, 5=debug, 4=info, 3=warn, 2=error, 1=fatal)")
 	logCaller := flag.Bool("logcaller", false, "log file/function/line")
+	flag.BoolVar(&dryRun, "n", false, "dry run: show what would be done, without writing anything")
+	flag.BoolVar(&dryRun, "dry-run", false, "dry run: show what would be done, without writing anything")
 
 	flag.Parse()
 
@@ -1122,6 +1800,21 @@ func main() {
 		log.SetReportCaller(true)
 	}
 
+	if flag.NArg() > 0 {
+		switch flag.Arg(0) {
+		case "import":
+			os.Exit(importFeed(flag.Args()[1:]))
+		case "init":
+			os.Exit(initProject(flag.Args()[1:]))
+		case "publish":
+			os.Exit(publish(flag.Args()[1:]))
+		case "serve":
+			os.Exit(serve(flag.Args()[1:]))
+		case "validate":
+			os.Exit(validate(flag.Args()[1:]))
+		}
+	}
+
 	if flag.NArg() == 0 {
 		processYAML(defaultYAML)
 		return
@@ -7,3 +7,26 @@ import (
 func TestMain(t *testing.T) {
 	t.Logf("TestMain")
 }
+
+func TestOutputName(t *testing.T) {
+	defaults = &Default{}
+	defer func() { defaults = initDefaults }()
+	for filename, want := range map[string]string{
+		"lesson01.mp3":           "lesson01.mp3",
+		"audio/lesson01.mp3":     "lesson01.mp3",
+		"/archive/lesson01.mp3":  "lesson01.mp3",
+		"../masters/lesson1.m4a": "lesson1.m4a",
+	} {
+		if got := outputName(&Track{Filename: filename}); got != want {
+			t.Errorf("outputName(%q) = %q, want %q", filename, got, want)
+		}
+	}
+}
+
+func TestNormalizeFilenameKeepsDirectory(t *testing.T) {
+	track := &Track{Filename: "audio/what?.mp3"}
+	track.NormalizeFilename()
+	if want := "audio/what_.mp3"; track.Filename != want {
+		t.Errorf("NormalizeFilename() = %q, want %q", track.Filename, want)
+	}
+}
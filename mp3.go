@@ -0,0 +1,282 @@
+package main
+
+// see http://www.mp3-tech.org/programmer/frame_header.html
+// http://gabriel.mp3-tech.org/mp3infotag.html
+// https://www.codeproject.com/Articles/8295/MPEG-Audio-Frame-Header
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/bogem/id3v2"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	mpegVersion25 = 0
+	mpegVersion2  = 2
+	mpegVersion1  = 3
+
+	mpegLayer3 = 1
+	mpegLayer2 = 2
+	mpegLayer1 = 3
+
+	mpegChannelModeMono = 3
+
+	// how far into the file to look for the first frame
+	mpegSyncSearchMax = 256 * 1024
+)
+
+// kilobits per second, indexed by [mpeg version 1 or 2][layer][bitrate index]
+var mpegBitrates = [2][4][16]int{
+	{ // MPEG 1
+		{},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},     // Layer III
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 0},    // Layer II
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448, 0}, // Layer I
+	},
+	{ // MPEG 2 & 2.5
+		{},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},      // Layer III
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},      // Layer II
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256, 0}, // Layer I
+	},
+}
+
+// hertz, indexed by [mpeg version][sample rate index]
+var mpegSampleRates = [4][4]int{
+	{11025, 12000, 8000, 0},  // MPEG 2.5
+	{0, 0, 0, 0},             // reserved
+	{22050, 24000, 16000, 0}, // MPEG 2
+	{44100, 48000, 32000, 0}, // MPEG 1
+}
+
+// mpegFrame is a decoded MPEG audio frame header
+type mpegFrame struct {
+	Version         int
+	Layer           int
+	Bitrate         int // kilobits per second
+	SampleRate      int // hertz
+	Padding         int
+	ChannelMode     int
+	SamplesPerFrame int
+	Length          int // bytes, including the header
+}
+
+func parseMpegFrame(b []byte) (frame *mpegFrame, ok bool) {
+	if len(b) < 4 {
+		return nil, false
+	}
+	if b[0] != 0xff || b[1]&0xe0 != 0xe0 {
+		return nil, false
+	}
+
+	frame = &mpegFrame{
+		Version:     int(b[1]>>3) & 0x03,
+		Layer:       int(b[1]>>1) & 0x03,
+		Padding:     int(b[2]>>1) & 0x01,
+		ChannelMode: int(b[3]>>6) & 0x03,
+	}
+	bitrateIndex := int(b[2]>>4) & 0x0f
+	sampleRateIndex := int(b[2]>>2) & 0x03
+
+	if frame.Version == 1 || frame.Layer == 0 || bitrateIndex == 0 || bitrateIndex == 15 || sampleRateIndex == 3 {
+		return nil, false
+	}
+
+	v := 1
+	if frame.Version == mpegVersion1 {
+		v = 0
+	}
+	frame.Bitrate = mpegBitrates[v][frame.Layer][bitrateIndex]
+	frame.SampleRate = mpegSampleRates[frame.Version][sampleRateIndex]
+
+	switch frame.Layer {
+	case mpegLayer1:
+		frame.SamplesPerFrame = 384
+		frame.Length = (12*frame.Bitrate*1000/frame.SampleRate + frame.Padding) * 4
+	case mpegLayer2:
+		frame.SamplesPerFrame = 1152
+		frame.Length = 144*frame.Bitrate*1000/frame.SampleRate + frame.Padding
+	case mpegLayer3:
+		if frame.Version == mpegVersion1 {
+			frame.SamplesPerFrame = 1152
+			frame.Length = 144*frame.Bitrate*1000/frame.SampleRate + frame.Padding
+		} else {
+			frame.SamplesPerFrame = 576
+			frame.Length = 72*frame.Bitrate*1000/frame.SampleRate + frame.Padding
+		}
+	}
+
+	return frame, true
+}
+
+// sideInfoLength returns the size of the Layer III side information that
+// follows the frame header, which is where a Xing/Info header is stored
+func (f *mpegFrame) sideInfoLength() int {
+	mono := f.ChannelMode == mpegChannelModeMono
+	if f.Version == mpegVersion1 {
+		if mono {
+			return 17
+		}
+		return 32
+	}
+	if mono {
+		return 9
+	}
+	return 17
+}
+
+// milliseconds returns the duration of frames frames
+func (f *mpegFrame) milliseconds(frames int64) int64 {
+	return frames * int64(f.SamplesPerFrame) * 1000 / int64(f.SampleRate)
+}
+
+// id3v2Length returns the size of an ID3v2 tag at the start of b, if any
+func id3v2Length(b []byte) int64 {
+	if len(b) < 10 || string(b[0:3]) != "ID3" {
+		return 0
+	}
+	// the size is stored as a 28 bit syncsafe integer
+	size := int64(b[6]&0x7f)<<21 | int64(b[7]&0x7f)<<14 | int64(b[8]&0x7f)<<7 | int64(b[9]&0x7f)
+	size += 10
+	if b[5]&0x10 != 0 {
+		// footer present
+		size += 10
+	}
+	return size
+}
+
+// getDurationViaMP3 determines the duration by reading the MPEG audio frames,
+// using the Xing/Info or VBRI header if present, then an existing TLEN frame,
+// and finally by assuming a constant bitrate
+func getDurationViaMP3(filename string) (durationMilliseconds int64, err error) {
+	fh, err := os.Open(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer fh.Close()
+
+	fi, err := fh.Stat()
+	if err != nil {
+		return 0, err
+	}
+	audioEnd := fi.Size()
+
+	header := make([]byte, 10)
+	_, err = io.ReadFull(fh, header)
+	if err != nil {
+		return 0, fmt.Errorf("%q: cannot read header: %s", filename, err)
+	}
+	audioStart := id3v2Length(header)
+
+	trailer := make([]byte, 3)
+	if audioEnd >= 128 {
+		_, err = fh.ReadAt(trailer, audioEnd-128)
+		if err == nil && string(trailer) == "TAG" {
+			// skip the ID3v1 tag
+			audioEnd -= 128
+		}
+	}
+
+	searchLength := int64(mpegSyncSearchMax)
+	if audioStart+searchLength > audioEnd {
+		searchLength = audioEnd - audioStart
+	}
+	if searchLength <= 0 {
+		return 0, fmt.Errorf("%q: no MPEG audio data found", filename)
+	}
+	buf := make([]byte, searchLength)
+	n, err := fh.ReadAt(buf, audioStart)
+	if err != nil && err != io.EOF {
+		return 0, fmt.Errorf("%q: cannot read audio data: %s", filename, err)
+	}
+	buf = buf[:n]
+
+	var frame *mpegFrame
+	offset := 0
+	for ; offset+4 <= len(buf); offset++ {
+		f, ok := parseMpegFrame(buf[offset:])
+		if !ok {
+			continue
+		}
+		// confirm the sync by checking the following frame, if we have it
+		next := offset + f.Length
+		if next+4 <= len(buf) {
+			if _, ok = parseMpegFrame(buf[next:]); !ok {
+				continue
+			}
+		}
+		frame = f
+		break
+	}
+	if frame == nil {
+		return 0, fmt.Errorf("%q: no MPEG audio frames found", filename)
+	}
+	log.Tracef("%q: first frame at %d: %+v", filename, audioStart+int64(offset), frame)
+
+	first := buf[offset:]
+
+	// Xing (VBR) or Info (CBR) header, stored in the side information area
+	xing := 4 + frame.sideInfoLength()
+	if xing+12 <= len(first) {
+		id := string(first[xing : xing+4])
+		if id == "Xing" || id == "Info" {
+			flags := binary.BigEndian.Uint32(first[xing+4:])
+			if flags&0x01 != 0 {
+				frames := int64(binary.BigEndian.Uint32(first[xing+8:]))
+				if frames > 0 {
+					log.Debugf("%q: %s header: %d frames", filename, id, frames)
+					return frame.milliseconds(frames), nil
+				}
+			}
+		}
+	}
+
+	// VBRI header, always 32 bytes after the frame header
+	vbri := 4 + 32
+	if vbri+18 <= len(first) && bytes.Equal(first[vbri:vbri+4], []byte("VBRI")) {
+		frames := int64(binary.BigEndian.Uint32(first[vbri+14:]))
+		if frames > 0 {
+			log.Debugf("%q: VBRI header: %d frames", filename, frames)
+			return frame.milliseconds(frames), nil
+		}
+	}
+
+	if audioStart > 0 {
+		durationMilliseconds, err = getDurationViaTLEN(filename)
+		if err == nil {
+			return durationMilliseconds, nil
+		}
+		log.Tracef("%q: %s", filename, err)
+	}
+
+	// no VBR header, so assume a constant bitrate
+	audioBytes := audioEnd - audioStart - int64(offset)
+	log.Debugf("%q: assuming CBR: %d kbps, %d bytes", filename, frame.Bitrate, audioBytes)
+	return audioBytes * 8 / int64(frame.Bitrate), nil
+}
+
+// getDurationViaTLEN returns the duration stored in the ID3v2 TLEN frame
+func getDurationViaTLEN(filename string) (durationMilliseconds int64, err error) {
+	tag, err := id3v2.Open(filename, id3v2.Options{Parse: true, ParseFrames: []string{"Length"}})
+	if err != nil {
+		return 0, err
+	}
+	defer tag.Close()
+
+	tf := tag.GetTextFrame(tag.CommonID("Length"))
+	if tf.Text == "" {
+		return 0, fmt.Errorf("no TLEN frame found")
+	}
+	durationMilliseconds, err = strconv.ParseInt(tf.Text, 10, 64)
+	if err != nil || durationMilliseconds <= 0 {
+		return 0, fmt.Errorf("invalid TLEN frame: %q", tf.Text)
+	}
+	log.Debugf("%q: TLEN frame: %d milliseconds", filename, durationMilliseconds)
+	return durationMilliseconds, nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bogem/id3v2"
+)
+
+// MPEG 1 Layer III, 128 kbps, 44100 Hz, no padding, stereo
+var testMpegHeader = []byte{0xff, 0xfb, 0x90, 0x00}
+
+const testMpegFrameLength = 417
+
+func writeTestMP3(t *testing.T, frames int, xingFrames int) string {
+	var buf bytes.Buffer
+	for i := 0; i < frames; i++ {
+		frame := make([]byte, testMpegFrameLength)
+		copy(frame, testMpegHeader)
+		if i == 0 && xingFrames > 0 {
+			copy(frame[36:], []byte("Xing"))
+			frame[43] = 0x01
+			frame[44] = byte(xingFrames >> 24)
+			frame[45] = byte(xingFrames >> 16)
+			frame[46] = byte(xingFrames >> 8)
+			frame[47] = byte(xingFrames)
+		}
+		buf.Write(frame)
+	}
+	filename := filepath.Join(t.TempDir(), "test.mp3")
+	err := ioutil.WriteFile(filename, buf.Bytes(), os.ModePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestGetDurationViaMP3(t *testing.T) {
+	tests := []struct {
+		frames     int
+		xingFrames int
+		want       int64
+	}{
+		{100, 0, 100 * testMpegFrameLength * 8 / 128},
+		{100, 1000, 1000 * 1152 * 1000 / 44100},
+	}
+	for _, tt := range tests {
+		filename := writeTestMP3(t, tt.frames, tt.xingFrames)
+		got, err := getDurationViaMP3(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("getDurationViaMP3(%d frames, xing %d) = %d, want %d", tt.frames, tt.xingFrames, got, tt.want)
+		}
+	}
+}
+
+func TestGetDurationViaMP3Tags(t *testing.T) {
+	cbr := int64(100 * testMpegFrameLength * 8 / 128)
+	tests := []struct {
+		name string
+		edit func(t *testing.T, filename string)
+		want int64
+	}{
+		{
+			"VBRI header",
+			func(t *testing.T, filename string) {
+				data, err := ioutil.ReadFile(filename)
+				if err != nil {
+					t.Fatal(err)
+				}
+				copy(data[4+32:], "VBRI")
+				binary.BigEndian.PutUint32(data[4+32+14:], 2000)
+				if err := ioutil.WriteFile(filename, data, 0644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			2000 * 1152 * 1000 / 44100,
+		},
+		{
+			"TLEN frame",
+			func(t *testing.T, filename string) {
+				tag, err := id3v2.Open(filename, id3v2.Options{Parse: true})
+				if err != nil {
+					t.Fatal(err)
+				}
+				tag.AddTextFrame(tag.CommonID("Length"), id3v2.EncodingISO, "61000")
+				if err := tag.Save(); err != nil {
+					t.Fatal(err)
+				}
+				tag.Close()
+			},
+			61000,
+		},
+		{
+			"ID3v2 tag without TLEN",
+			func(t *testing.T, filename string) {
+				tag, err := id3v2.Open(filename, id3v2.Options{Parse: true})
+				if err != nil {
+					t.Fatal(err)
+				}
+				tag.SetTitle("Title")
+				if err := tag.Save(); err != nil {
+					t.Fatal(err)
+				}
+				tag.Close()
+			},
+			cbr,
+		},
+		{
+			"ID3v1 tag",
+			func(t *testing.T, filename string) {
+				f, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+				trailer := make([]byte, 128)
+				copy(trailer, "TAGTitle")
+				f.Write(trailer)
+				f.Close()
+			},
+			cbr,
+		},
+	}
+	for _, tt := range tests {
+		filename := writeTestMP3(t, 100, 0)
+		tt.edit(t, filename)
+		got, err := getDurationViaMP3(filename)
+		if err != nil {
+			t.Errorf("getDurationViaMP3() with a %s: %s", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("getDurationViaMP3() with a %s = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,482 @@
+package main
+
+// see https://developer.apple.com/library/archive/documentation/QuickTime/QTFF/Metadata/Metadata.html
+// https://atomicparsley.sourceforge.net/mpeg-4files.html
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// iTunes metadata item atoms (\xa9 is the copyright sign in Mac OS Roman)
+	mp4Album       = "\xa9alb"
+	mp4AlbumArtist = "aART"
+	mp4Artist      = "\xa9ART"
+	mp4Composer    = "\xa9wrt"
+	mp4Copyright   = "cprt"
+	mp4Cover       = "covr"
+	mp4Description = "desc"
+	mp4Disc        = "disk"
+	mp4EncodedBy   = "\xa9too"
+	mp4Genre       = "\xa9gen"
+	mp4Lyrics      = "\xa9lyr"
+	mp4Title       = "\xa9nam"
+	mp4Track       = "trkn"
+	mp4Year        = "\xa9day"
+
+	// well-known data types
+	mp4TypeImplicit = 0
+	mp4TypeUTF8     = 1
+	mp4TypeJPEG     = 13
+	mp4TypePNG      = 14
+)
+
+// atoms that only contain other atoms
+var mp4Containers = map[string]bool{
+	"moov": true,
+	"trak": true,
+	"mdia": true,
+	"minf": true,
+	"stbl": true,
+	"udta": true,
+	"edts": true,
+	"dinf": true,
+	"meta": true,
+	"ilst": true,
+}
+
+type mp4Atom struct {
+	Type string
+	// Prefix holds the version and flags of full atoms that contain other atoms (meta)
+	Prefix   []byte
+	Data     []byte
+	Children []*mp4Atom
+}
+
+// MP4File holds the iTunes metadata to be written to an MP4 (.m4a, .m4v, .mp4) file
+type MP4File struct {
+	filename   string
+	moovOffset int64
+	moovSize   int64
+	moov       *mp4Atom
+	items      []*mp4Atom
+}
+
+// readMP4AtomHeader returns the type, total size and header size of the atom at offset
+func readMP4AtomHeader(r io.ReaderAt, offset int64, end int64) (atomType string, size int64, headerSize int64, err error) {
+	b := make([]byte, 16)
+	_, err = r.ReadAt(b[:8], offset)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	atomType = string(b[4:8])
+	size = int64(binary.BigEndian.Uint32(b[0:4]))
+	headerSize = 8
+	switch size {
+	case 0:
+		// extends to the end of the file
+		size = end - offset
+	case 1:
+		_, err = r.ReadAt(b[8:16], offset+8)
+		if err != nil {
+			return "", 0, 0, err
+		}
+		size = int64(binary.BigEndian.Uint64(b[8:16]))
+		headerSize = 16
+	}
+	if size < headerSize || offset+size > end {
+		return "", 0, 0, fmt.Errorf("invalid size %d for atom %q at offset %d", size, atomType, offset)
+	}
+	return atomType, size, headerSize, nil
+}
+
+func parseMP4Atoms(b []byte) (atoms []*mp4Atom, err error) {
+	r := bytes.NewReader(b)
+	end := int64(len(b))
+	for offset := int64(0); offset+8 <= end; {
+		atomType, size, headerSize, err := readMP4AtomHeader(r, offset, end)
+		if err != nil {
+			return nil, err
+		}
+		atom := &mp4Atom{Type: atomType}
+		data := b[offset+headerSize : offset+size]
+		if mp4Containers[atomType] {
+			if atomType == "meta" && len(data) >= 8 && string(data[4:8]) != "hdlr" {
+				// ISO style meta atoms have a version and flags, QuickTime style do not
+				atom.Prefix = data[0:4]
+				data = data[4:]
+			}
+			atom.Children, err = parseMP4Atoms(data)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			atom.Data = data
+		}
+		atoms = append(atoms, atom)
+		offset += size
+	}
+	return atoms, nil
+}
+
+func (a *mp4Atom) size() int64 {
+	size := int64(8 + len(a.Prefix) + len(a.Data))
+	for _, child := range a.Children {
+		size += child.size()
+	}
+	return size
+}
+
+func (a *mp4Atom) bytes() []byte {
+	var buf bytes.Buffer
+	a.writeTo(&buf)
+	return buf.Bytes()
+}
+
+func (a *mp4Atom) writeTo(buf *bytes.Buffer) {
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header[0:4], uint32(a.size()))
+	copy(header[4:8], a.Type)
+	buf.Write(header)
+	buf.Write(a.Prefix)
+	buf.Write(a.Data)
+	for _, child := range a.Children {
+		child.writeTo(buf)
+	}
+}
+
+func (a *mp4Atom) child(atomType string) *mp4Atom {
+	for _, child := range a.Children {
+		if child.Type == atomType {
+			return child
+		}
+	}
+	return nil
+}
+
+// walk calls fn for a and all of its descendants
+func (a *mp4Atom) walk(fn func(*mp4Atom)) {
+	fn(a)
+	for _, child := range a.Children {
+		child.walk(fn)
+	}
+}
+
+// findMP4Moov returns the offset and size of the top level moov atom
+func findMP4Moov(fh *os.File) (offset int64, size int64, err error) {
+	fi, err := fh.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	end := fi.Size()
+	for offset = 0; offset+8 <= end; offset += size {
+		var atomType string
+		atomType, size, _, err = readMP4AtomHeader(fh, offset, end)
+		if err != nil {
+			return 0, 0, err
+		}
+		if atomType == "moov" {
+			return offset, size, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("no moov atom found")
+}
+
+// OpenMP4 reads the moov atom of filename
+func OpenMP4(filename string) (f *MP4File, err error) {
+	fh, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	f = &MP4File{filename: filename}
+	f.moovOffset, f.moovSize, err = findMP4Moov(fh)
+	if err != nil {
+		return nil, fmt.Errorf("%q: %s", filename, err)
+	}
+	b := make([]byte, f.moovSize)
+	_, err = fh.ReadAt(b, f.moovOffset)
+	if err != nil {
+		return nil, fmt.Errorf("%q: cannot read moov atom: %s", filename, err)
+	}
+	atoms, err := parseMP4Atoms(b)
+	if err != nil || len(atoms) != 1 {
+		return nil, fmt.Errorf("%q: cannot parse moov atom: %v", filename, err)
+	}
+	f.moov = atoms[0]
+	return f, nil
+}
+
+// Duration returns the duration stored in the movie header (mvhd) atom
+func (f *MP4File) Duration() (durationMilliseconds int64, err error) {
+	mvhd := f.moov.child("mvhd")
+	if mvhd == nil || len(mvhd.Data) < 20 {
+		return 0, fmt.Errorf("%q: no mvhd atom found", f.filename)
+	}
+	var timescale, duration uint64
+	if mvhd.Data[0] == 1 {
+		if len(mvhd.Data) < 32 {
+			return 0, fmt.Errorf("%q: invalid mvhd atom", f.filename)
+		}
+		timescale = uint64(binary.BigEndian.Uint32(mvhd.Data[20:24]))
+		duration = binary.BigEndian.Uint64(mvhd.Data[24:32])
+	} else {
+		timescale = uint64(binary.BigEndian.Uint32(mvhd.Data[12:16]))
+		duration = uint64(binary.BigEndian.Uint32(mvhd.Data[16:20]))
+	}
+	if timescale == 0 {
+		return 0, fmt.Errorf("%q: invalid mvhd timescale", f.filename)
+	}
+	return int64(duration * 1000 / timescale), nil
+}
+
+func (f *MP4File) setItem(itemType string, dataType uint32, value []byte) {
+	data := make([]byte, 8, 8+len(value))
+	binary.BigEndian.PutUint32(data[0:4], dataType)
+	data = append(data, value...)
+	item := &mp4Atom{
+		Type:     itemType,
+		Children: []*mp4Atom{{Type: "data", Data: data}},
+	}
+	for i, old := range f.items {
+		if old.Type == itemType {
+			f.items[i] = item
+			return
+		}
+	}
+	f.items = append(f.items, item)
+}
+
+// SetText sets a text item, such as mp4Title
+func (f *MP4File) SetText(itemType string, text string) {
+	if text == "" {
+		return
+	}
+	f.setItem(itemType, mp4TypeUTF8, []byte(text))
+}
+
+// SetNumber sets a number/total item (mp4Track or mp4Disc)
+func (f *MP4File) SetNumber(itemType string, number int, total int) {
+	if number <= 0 {
+		return
+	}
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint16(value[2:4], uint16(number))
+	binary.BigEndian.PutUint16(value[4:6], uint16(total))
+	if itemType == mp4Disc {
+		value = value[:6]
+	}
+	f.setItem(itemType, mp4TypeImplicit, value)
+}
+
+// SetCover sets the cover art
+func (f *MP4File) SetCover(mimeType string, picture []byte) {
+	dataType := uint32(mp4TypeJPEG)
+	if mimeType == "image/png" {
+		dataType = mp4TypePNG
+	}
+	f.setItem(mp4Cover, dataType, picture)
+}
+
+// Values returns the metadata items as strings, keyed by item type,
+// including the items that Save would write
+func (f *MP4File) Values() map[string]string {
+	rv := make(map[string]string)
+	if udta := f.moov.child("udta"); udta != nil {
+		if meta := udta.child("meta"); meta != nil {
+			if ilst := meta.child("ilst"); ilst != nil {
+				for _, item := range ilst.Children {
+					rv[mp4ItemName(item.Type)] = mp4ItemValue(item)
+				}
+			}
+		}
+	}
+	for _, item := range f.items {
+		rv[mp4ItemName(item.Type)] = mp4ItemValue(item)
+	}
+	return rv
+}
+
+// mp4ItemName returns the item type with \xa9 converted to UTF-8
+func mp4ItemName(itemType string) string {
+	return strings.Replace(itemType, "\xa9", "\u00a9", -1)
+}
+
+func mp4ItemValue(item *mp4Atom) string {
+	var data []byte
+	if len(item.Children) > 0 {
+		data = item.Children[0].Data
+	} else if len(item.Data) >= 8 && string(item.Data[4:8]) == "data" {
+		size := int(binary.BigEndian.Uint32(item.Data[0:4]))
+		if size > len(item.Data) || size < 8 {
+			size = len(item.Data)
+		}
+		data = item.Data[8:size]
+	}
+	if len(data) < 8 {
+		return fmt.Sprintf("%d bytes", len(item.Data))
+	}
+	dataType := binary.BigEndian.Uint32(data[0:4]) & 0xffffff
+	value := data[8:]
+	switch {
+	case dataType == mp4TypeUTF8:
+		return string(value)
+	case (item.Type == mp4Track || item.Type == mp4Disc) && len(value) >= 6:
+		return fmt.Sprintf("%d/%d", binary.BigEndian.Uint16(value[2:4]), binary.BigEndian.Uint16(value[4:6]))
+	}
+	return fmt.Sprintf("%d bytes", len(value))
+}
+
+// ilst returns the moov/udta/meta/ilst atom, creating it if needed
+func (f *MP4File) ilst() *mp4Atom {
+	udta := f.moov.child("udta")
+	if udta == nil {
+		udta = &mp4Atom{Type: "udta"}
+		f.moov.Children = append(f.moov.Children, udta)
+	}
+	meta := udta.child("meta")
+	if meta == nil {
+		hdlr := make([]byte, 25)
+		copy(hdlr[8:12], "mdir")
+		copy(hdlr[12:16], "appl")
+		meta = &mp4Atom{
+			Type:     "meta",
+			Prefix:   make([]byte, 4),
+			Children: []*mp4Atom{{Type: "hdlr", Data: hdlr}},
+		}
+		udta.Children = append(udta.Children, meta)
+	}
+	ilst := meta.child("ilst")
+	if ilst == nil {
+		ilst = &mp4Atom{Type: "ilst"}
+		meta.Children = append(meta.Children, ilst)
+	}
+	return ilst
+}
+
+// adjustChunkOffsets moves the chunk offsets of the media data found after
+// the moov atom by delta bytes
+func (f *MP4File) adjustChunkOffsets(delta int64) {
+	moovEnd := uint64(f.moovOffset + f.moovSize)
+	f.moov.walk(func(a *mp4Atom) {
+		if (a.Type != "stco" && a.Type != "co64") || len(a.Data) < 8 {
+			return
+		}
+		count := int(binary.BigEndian.Uint32(a.Data[4:8]))
+		data := make([]byte, len(a.Data))
+		copy(data, a.Data)
+		for i := 0; i < count; i++ {
+			if a.Type == "stco" {
+				p := 8 + i*4
+				if p+4 > len(data) {
+					break
+				}
+				offset := uint64(binary.BigEndian.Uint32(data[p:]))
+				if offset >= moovEnd {
+					binary.BigEndian.PutUint32(data[p:], uint32(int64(offset)+delta))
+				}
+				continue
+			}
+			p := 8 + i*8
+			if p+8 > len(data) {
+				break
+			}
+			offset := binary.BigEndian.Uint64(data[p:])
+			if offset >= moovEnd {
+				binary.BigEndian.PutUint64(data[p:], uint64(int64(offset)+delta))
+			}
+		}
+		a.Data = data
+	})
+}
+
+// Save rewrites the file with the new metadata items
+func (f *MP4File) Save() (err error) {
+	ilst := f.ilst()
+	var children []*mp4Atom
+	replaced := make(map[string]bool)
+	for _, item := range f.items {
+		replaced[item.Type] = true
+	}
+	for _, child := range ilst.Children {
+		if !replaced[child.Type] {
+			children = append(children, child)
+		}
+	}
+	ilst.Children = append(children, f.items...)
+
+	delta := f.moov.size() - f.moovSize
+	if delta != 0 {
+		f.adjustChunkOffsets(delta)
+	}
+	moov := f.moov.bytes()
+	if int64(len(moov)) > 0xffffffff {
+		return fmt.Errorf("%q: moov atom is too large", f.filename)
+	}
+
+	in, err := os.Open(f.filename)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := ioutil.TempFile(filepath.Dir(f.filename), filepath.Base(f.filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			out.Close()
+			os.Remove(out.Name())
+		}
+	}()
+
+	_, err = io.Copy(out, io.NewSectionReader(in, 0, f.moovOffset))
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(moov)
+	if err != nil {
+		return err
+	}
+	moovEnd := f.moovOffset + f.moovSize
+	_, err = io.Copy(out, io.NewSectionReader(in, moovEnd, fi.Size()-moovEnd))
+	if err != nil {
+		return err
+	}
+	err = out.Close()
+	if err != nil {
+		return err
+	}
+	in.Close()
+
+	log.Debugf("Saving %q (moov atom changed by %d bytes)", f.filename, delta)
+	err = os.Chmod(out.Name(), fi.Mode())
+	if err != nil {
+		return err
+	}
+	return os.Rename(out.Name(), f.filename)
+}
+
+// getDurationViaMP4 determines the duration by reading the MP4 movie header
+func getDurationViaMP4(filename string) (durationMilliseconds int64, err error) {
+	f, err := OpenMP4(filename)
+	if err != nil {
+		return 0, err
+	}
+	return f.Duration()
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestMP4 writes ftyp, moov (with an mvhd and an stco pointing into mdat) and mdat atoms
+func writeTestMP4(t *testing.T) (filename string, payload []byte) {
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:16], 1000)  // timescale
+	binary.BigEndian.PutUint32(mvhd[16:20], 65432) // duration
+
+	stco := make([]byte, 12)
+	binary.BigEndian.PutUint32(stco[4:8], 1)
+
+	moov := &mp4Atom{Type: "moov", Children: []*mp4Atom{
+		{Type: "mvhd", Data: mvhd},
+		{Type: "trak", Children: []*mp4Atom{
+			{Type: "mdia", Children: []*mp4Atom{
+				{Type: "minf", Children: []*mp4Atom{
+					{Type: "stbl", Children: []*mp4Atom{
+						{Type: "stco", Data: stco},
+					}},
+				}},
+			}},
+		}},
+	}}
+	ftyp := &mp4Atom{Type: "ftyp", Data: []byte("M4A \x00\x00\x00\x00M4A isom")}
+	payload = []byte("audio data")
+	mdat := &mp4Atom{Type: "mdat", Data: payload}
+
+	// the chunk offset points just past the mdat header
+	binary.BigEndian.PutUint32(stco[8:12], uint32(ftyp.size()+moov.size()+8))
+
+	var buf bytes.Buffer
+	ftyp.writeTo(&buf)
+	moov.writeTo(&buf)
+	mdat.writeTo(&buf)
+
+	filename = filepath.Join(t.TempDir(), "test.m4a")
+	err := ioutil.WriteFile(filename, buf.Bytes(), os.ModePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filename, payload
+}
+
+func TestMP4File(t *testing.T) {
+	filename, payload := writeTestMP4(t)
+
+	if got := getEnclosureType(filename); !isMP4(got) {
+		t.Fatalf("getEnclosureType() = %v, want an MP4 type", got)
+	}
+
+	f, err := OpenMP4(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	duration, err := f.Duration()
+	if err != nil || duration != 65432 {
+		t.Errorf("Duration() = %d, %v, want 65432", duration, err)
+	}
+
+	f.SetText(mp4Title, "Seated Meditation")
+	f.SetNumber(mp4Track, 3, 10)
+	err = f.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err = OpenMP4(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	title := f.ilst().child(mp4Title)
+	if title == nil || string(title.Data[16:]) != "Seated Meditation" {
+		t.Errorf("title not saved: %+v", title)
+	}
+
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var offset uint32
+	f.moov.walk(func(a *mp4Atom) {
+		if a.Type == "stco" {
+			offset = binary.BigEndian.Uint32(a.Data[8:12])
+		}
+	})
+	if int(offset)+len(payload) > len(b) || !bytes.Equal(b[offset:int(offset)+len(payload)], payload) {
+		t.Errorf("chunk offset %d does not point to the media data", offset)
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+// dry-run (-n) support: report what would be done, without writing anything
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/bogem/id3v2"
+	fpodcast "github.com/rasa/feedster/podcast"
+	log "github.com/sirupsen/logrus"
+)
+
+// maximum number of lines compared by diffLines, past the common prefix and suffix
+const diffLinesMax = 4 * 1024 * 1024
+
+var dryRun bool
+
+// planOutput receives the plan
+var planOutput io.Writer = os.Stdout
+
+func planMkdir(dir string) {
+	fmt.Fprintf(planOutput, "mkdir  %q\n", dir)
+}
+
+func planCopy(src, dst string) {
+	fmt.Fprintf(planOutput, "copy   %q -> %q\n", src, dst)
+}
+
+func planEncode(src, dst string) {
+	fmt.Fprintf(planOutput, "encode %q -> %q\n", src, dst)
+}
+
+func planGUID(key, guid string) {
+	fmt.Fprintf(planOutput, "guid   %q -> %q\n", key, guid)
+}
+
+func planUpload(filename, url string) {
+	fmt.Fprintf(planOutput, "upload %q -> %q\n", filename, url)
+}
+
+func planRename(oldName, newName string) {
+	fmt.Fprintf(planOutput, "rename %q -> %q\n", oldName, newName)
+}
+
+// planTags prints the tag values that would be added, changed or removed
+func planTags(filename string, before map[string]string, after map[string]string) {
+	var ids []string
+	for id := range after {
+		ids = append(ids, id)
+	}
+	for id := range before {
+		if _, ok := after[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	changed := false
+	for _, id := range ids {
+		oldValue, hadOld := before[id]
+		newValue, hasNew := after[id]
+		if hadOld && hasNew && oldValue == newValue {
+			continue
+		}
+		if !changed {
+			fmt.Fprintf(planOutput, "tag    %q\n", filename)
+			changed = true
+		}
+		switch {
+		case !hadOld:
+			fmt.Fprintf(planOutput, "         %-4s: (none) -> %q\n", id, newValue)
+		case !hasNew:
+			fmt.Fprintf(planOutput, "         %-4s: %q -> (none)\n", id, oldValue)
+		default:
+			fmt.Fprintf(planOutput, "         %-4s: %q -> %q\n", id, oldValue, newValue)
+		}
+	}
+	if !changed {
+		fmt.Fprintf(planOutput, "tag    %q (unchanged)\n", filename)
+	}
+}
+
+// id3Values returns the tag's frames as strings, keyed by frame ID
+func id3Values(tag *id3v2.Tag) map[string]string {
+	rv := make(map[string]string)
+	for id, frames := range tag.AllFrames() {
+		var values []string
+		for _, f := range frames {
+			switch frame := f.(type) {
+			case id3v2.TextFrame:
+				values = append(values, frame.Text)
+			case id3v2.CommentFrame:
+				values = append(values, frame.Description+": "+frame.Text)
+			case id3v2.PictureFrame:
+				values = append(values, fmt.Sprintf("%s: %s, %d bytes", frame.Description, frame.MimeType, len(frame.Picture)))
+			case id3v2.UnsynchronisedLyricsFrame:
+				values = append(values, frame.ContentDescriptor+": "+frame.Lyrics)
+			case id3v2.UserDefinedTextFrame:
+				values = append(values, frame.Description+": "+frame.Value)
+			default:
+				values = append(values, fmt.Sprintf("%d bytes", f.Size()))
+			}
+		}
+		sort.Strings(values)
+		rv[id] = strings.Join(values, "; ")
+	}
+	return rv
+}
+
+// planTrack reports what processTrack would do to the track
+func planTrack(track *Track, tracks []*Track) {
+	if entry := cache.Current(track, tagFingerprint(track, tracks)); entry != nil {
+		fmt.Fprintf(planOutput, "skip   %q (unchanged)\n", track.Filename)
+		if entry.OutputName != "" {
+			track.OutputName = entry.OutputName
+			track.FileSize = entry.OutputSize
+		} else {
+			track.FileSize = entry.Size
+		}
+		return
+	}
+
+	if !defaults.tagInPlace {
+		newTrackName := outputName(track)
+		if newTrackName != track.Filename {
+			planRename(track.Filename, newTrackName)
+		}
+		planCopy(track.Filename, defaults.OutputDir+newTrackName)
+		track.OutputName = newTrackName
+	}
+
+	// the copy would be identical to the original, so read the original's tags
+	target := track.Filename
+	if track.OutputName != "" {
+		target = defaults.OutputDir + track.OutputName
+	}
+
+	switch {
+	case track.EnclosureType == fpodcast.AAC:
+		fmt.Fprintf(planOutput, "skip   %q (raw AAC files have no tags)\n", target)
+	case isMP4(track.EnclosureType):
+		f, err := OpenMP4(track.Filename)
+		if err != nil {
+			log.Fatalf("Cannot open %q: %s", track.Filename, err)
+		}
+		before := f.Values()
+		setMP4Tags(f, track, tracks)
+		planTags(target, before, f.Values())
+	default:
+		tag, err := id3v2.Open(track.Filename, id3v2.Options{Parse: true})
+		if err != nil {
+			log.Fatalf("Cannot open %q: %s", track.Filename, err)
+		}
+		before := id3Values(tag)
+		setTags(tag, track, tracks)
+		after := id3Values(tag)
+		if n := len(track.ChapterList); n > 0 {
+			after["CHAP"] = fmt.Sprintf("%d chapters", n)
+		}
+		planTags(target, before, after)
+		tag.Close()
+	}
+
+	// the tags would change the size, but this is the best we can do
+	track.FileSize = track.OriginalFileSize
+}
+
+// planFeed prints the differences between the existing feed and the new one
+func planFeed(filename string, data []byte) {
+	old, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("Cannot read %q: %s", filename, err)
+		}
+		fmt.Fprintf(planOutput, "create %q (%d bytes)\n", filename, len(data))
+		return
+	}
+	if bytes.Equal(old, data) {
+		fmt.Fprintf(planOutput, "write  %q (unchanged)\n", filename)
+		return
+	}
+	fmt.Fprintf(planOutput, "write  %q\n", filename)
+	fmt.Fprintf(planOutput, "--- %s\n+++ %s\n", filename, filename)
+	for _, line := range diffLines(splitLines(string(old)), splitLines(string(data))) {
+		fmt.Fprintln(planOutput, line)
+	}
+}
+
+func splitLines(s string) []string {
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines returns the lines of a and b that differ, prefixed by - or +
+func diffLines(a, b []string) (rv []string) {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	a = a[prefix : len(a)-suffix]
+	b = b[prefix : len(b)-suffix]
+
+	if len(a)*len(b) > diffLinesMax {
+		for _, line := range a {
+			rv = append(rv, "-"+line)
+		}
+		for _, line := range b {
+			rv = append(rv, "+"+line)
+		}
+		return rv
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int32, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			rv = append(rv, "-"+a[i])
+			i++
+		default:
+			rv = append(rv, "+"+b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		rv = append(rv, "-"+a[i])
+	}
+	for ; j < len(b); j++ {
+		rv = append(rv, "+"+b[j])
+	}
+	return rv
+}
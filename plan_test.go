@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		a, b []string
+		want []string
+	}{
+		{[]string{"a", "b", "c"}, []string{"a", "b", "c"}, nil},
+		{[]string{"a", "b", "c"}, []string{"a", "x", "c"}, []string{"-b", "+x"}},
+		{[]string{"a", "c"}, []string{"a", "b", "c"}, []string{"+b"}},
+		{[]string{"a", "b", "c"}, []string{"a", "c"}, []string{"-b"}},
+		{[]string{"a", "b", "c", "d"}, []string{"b", "c", "d", "e"}, []string{"-a", "+e"}},
+		{[]string{"a", "b"}, []string{"c", "d"}, []string{"-a", "-b", "+c", "+d"}},
+		{[]string{"x", "a", "y", "b", "z"}, []string{"x", "b", "y", "a", "z"}, []string{"-a", "-y", "+y", "+a"}},
+		{nil, []string{"a"}, []string{"+a"}},
+		{[]string{"a"}, nil, []string{"-a"}},
+	}
+	for _, tt := range tests {
+		if got := diffLines(tt.a, tt.b); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("diffLines(%q, %q) = %q, want %q", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestPlanTags(t *testing.T) {
+	defer func(w io.Writer) { planOutput = w }(planOutput)
+	tests := []struct {
+		before, after map[string]string
+		want          string
+	}{
+		{
+			map[string]string{"TIT2": "a"},
+			map[string]string{"TIT2": "a"},
+			"tag    \"x.mp3\" (unchanged)\n",
+		},
+		{
+			map[string]string{"TIT2": "a", "TPE1": "b"},
+			map[string]string{"TIT2": "c", "TALB": "d"},
+			"tag    \"x.mp3\"\n" +
+				"         TALB: (none) -> \"d\"\n" +
+				"         TIT2: \"a\" -> \"c\"\n" +
+				"         TPE1: \"b\" -> (none)\n",
+		},
+		{
+			nil,
+			map[string]string{"TIT2": "a"},
+			"tag    \"x.mp3\"\n" +
+				"         TIT2: (none) -> \"a\"\n",
+		},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		planOutput = &buf
+		planTags("x.mp3", tt.before, tt.after)
+		if got := buf.String(); got != tt.want {
+			t.Errorf("planTags(%v, %v) = %q, want %q", tt.before, tt.after, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package podcast
+
+import (
+	"encoding/xml"
+	"io"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+// Specifications: https://tools.ietf.org/html/rfc4287
+//
+
+const (
+	atomNS   = "http://www.w3.org/2005/Atom"
+	atomType = "application/atom+xml"
+	rssType  = "application/rss+xml"
+	atomHTML = "html"
+	atomText = "text"
+)
+
+var (
+	// "<p>", "</a>", etc.
+	htmlTagRegex = regexp.MustCompile(`</?[a-zA-Z][^>]*>`)
+	uuidRegex    = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+)
+
+// IsHTML returns true if s contains HTML tags
+func IsHTML(s string) bool {
+	return htmlTagRegex.MatchString(s)
+}
+
+type atomFeed struct {
+	XMLName    xml.Name        `xml:"feed"`
+	NS         string          `xml:"xmlns,attr"`
+	Lang       string          `xml:"xml:lang,attr,omitempty"`
+	ID         string          `xml:"id"`
+	Title      atomTextElement `xml:"title"`
+	Subtitle   *atomTextElement
+	Updated    string         `xml:"updated"`
+	Authors    []atomPerson   `xml:"author"`
+	Links      []atomLink     `xml:"link"`
+	Categories []atomCategory `xml:"category"`
+	Generator  string         `xml:"generator,omitempty"`
+	Logo       string         `xml:"logo,omitempty"`
+	Rights     string         `xml:"rights,omitempty"`
+	Entries    []atomEntry    `xml:"entry"`
+}
+
+type atomTextElement struct {
+	XMLName xml.Name
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+type atomPerson struct {
+	Name  string `xml:"name"`
+	Email string `xml:"email,omitempty"`
+}
+
+type atomLink struct {
+	HREF   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr,omitempty"`
+	Type   string `xml:"type,attr,omitempty"`
+	Title  string `xml:"title,attr,omitempty"`
+	Length int64  `xml:"length,attr,omitempty"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomEntry struct {
+	ID        string          `xml:"id"`
+	Title     atomTextElement `xml:"title"`
+	Updated   string          `xml:"updated"`
+	Published string          `xml:"published,omitempty"`
+	Authors   []atomPerson    `xml:"author"`
+	Links     []atomLink      `xml:"link"`
+	Summary   *atomTextElement
+	Content   *atomTextElement
+}
+
+// atomTextConstruct returns s as an Atom text construct named name, of type
+// html, if it contains HTML tags, or else text.
+func atomTextConstruct(name string, s string) *atomTextElement {
+	if s == "" {
+		return nil
+	}
+	t := &atomTextElement{XMLName: xml.Name{Local: name}, Type: atomText, Text: s}
+	if IsHTML(s) {
+		t.Type = atomHTML
+	}
+	return t
+}
+
+// atomDate returns t in the RFC 3339 format Atom requires.
+func atomDate(t time.Time) string {
+	return t.Format(time.RFC3339)
+}
+
+// atomID returns guid as an Atom id, which must be an IRI: URLs are used
+// as-is, UUIDs as urn:uuid: URNs, and anything else as a tag: URI (RFC 4151),
+// of the feed's link's host, dated 2005, the year Atom was published.
+func atomID(guid string, link string) string {
+	if uuidRegex.MatchString(guid) {
+		return "urn:uuid:" + guid
+	}
+	u, err := url.Parse(guid)
+	if err == nil && u.IsAbs() {
+		return guid
+	}
+	host := "localhost"
+	if l, err := url.Parse(link); err == nil && l.Host != "" {
+		host = l.Hostname()
+	}
+	return "tag:" + host + ",2005:" + url.PathEscape(guid)
+}
+
+// EncodeAtom writes the podcast to w as an Atom 1.0 feed, whose URL is
+// selfURL. The items' enclosures are links with rel="enclosure", and their
+// ids are the items' GUIDs. The RSS feed, if AtomLink refers to it, is
+// linked as an alternate.
+func (p *Podcast) EncodeAtom(w io.Writer, selfURL string) error {
+	f := atomFeed{
+		NS:        atomNS,
+		Lang:      p.Language,
+		ID:        selfURL,
+		Title:     atomTextElement{XMLName: xml.Name{Local: "title"}, Type: atomText, Text: p.Title},
+		Subtitle:  atomTextConstruct("subtitle", p.Description),
+		Generator: p.Generator,
+		Rights:    p.Copyright,
+	}
+	if p.PGUID != "" {
+		f.ID = atomID(p.PGUID, p.Link)
+	}
+
+	updated := time.Time{}
+	for _, layout := range []string{time.RFC1123Z, time.RFC1123} {
+		if t, err := time.Parse(layout, p.LastBuildDate); err == nil {
+			updated = t
+			break
+		}
+	}
+
+	author := atomPerson{Name: p.IAuthor}
+	if p.IOwner != nil {
+		if author.Name == "" {
+			author.Name = p.IOwner.Name
+		}
+		author.Email = p.IOwner.Email
+	}
+	if author.Name != "" {
+		f.Authors = append(f.Authors, author)
+	}
+
+	f.Links = append(f.Links, atomLink{HREF: selfURL, Rel: "self", Type: atomType})
+	if p.Link != "" {
+		f.Links = append(f.Links, atomLink{HREF: p.Link, Rel: "alternate", Type: "text/html"})
+	}
+	if p.AtomLink != nil && p.AtomLink.HREF != "" && p.AtomLink.HREF != selfURL {
+		f.Links = append(f.Links, atomLink{HREF: p.AtomLink.HREF, Rel: "alternate", Type: rssType})
+	}
+
+	for _, c := range p.ICategories {
+		f.Categories = append(f.Categories, atomCategory{Term: c.Text})
+		for _, sub := range c.ICategories {
+			f.Categories = append(f.Categories, atomCategory{Term: sub.Text})
+		}
+	}
+
+	if p.IImage != nil {
+		f.Logo = p.IImage.HREF
+	} else if p.Image != nil {
+		f.Logo = p.Image.URL
+	}
+
+	for _, i := range p.Items {
+		e := atomEntry{
+			ID:    atomID(i.GUID, p.Link),
+			Title: atomTextElement{XMLName: xml.Name{Local: "title"}, Type: atomText, Text: i.Title},
+		}
+		if i.PubDate != nil {
+			e.Published = atomDate(*i.PubDate)
+			e.Updated = e.Published
+			if i.PubDate.After(updated) {
+				updated = *i.PubDate
+			}
+		}
+		if i.IAuthor != "" && i.IAuthor != author.Name {
+			e.Authors = append(e.Authors, atomPerson{Name: i.IAuthor})
+		}
+		if i.Link != "" {
+			e.Links = append(e.Links, atomLink{HREF: i.Link, Rel: "alternate"})
+		}
+		if i.Enclosure != nil {
+			mimeType := i.Enclosure.TypeFormatted
+			if mimeType == "" {
+				mimeType = i.Enclosure.Type.String()
+			}
+			e.Links = append(e.Links, atomLink{
+				HREF:   i.Enclosure.URL,
+				Rel:    "enclosure",
+				Type:   mimeType,
+				Title:  i.Title,
+				Length: i.Enclosure.Length,
+			})
+		}
+		e.Summary = atomTextConstruct("summary", i.ISubtitle)
+		e.Content = atomTextConstruct("content", i.Description)
+		f.Entries = append(f.Entries, e)
+	}
+
+	if updated.IsZero() {
+		updated = time.Now().UTC()
+	}
+	f.Updated = atomDate(updated)
+	for j := range f.Entries {
+		if f.Entries[j].Updated == "" {
+			f.Entries[j].Updated = f.Updated
+		}
+	}
+
+	if _, err := w.Write([]byte("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")); err != nil {
+		return err
+	}
+	return p.encode(w, f)
+}
@@ -0,0 +1,64 @@
+package podcast
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncodeAtom(t *testing.T) {
+	pubDate := time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC)
+	p := New("Show", "https://example.com/", "A <b>show</b>", &pubDate, &pubDate)
+	p.AddAtomLink("https://example.com/show.xml")
+	item := Item{Title: "One", Description: "First", PubDate: &pubDate, GUID: "bf984bb1-49d1-4468-b5eb-3b4baec0c34c"}
+	item.AddEnclosure("https://example.com/one.mp3", MP3, 1234)
+	if _, err := p.AddItem(item); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := p.EncodeAtom(&buf, "https://example.com/show.atom"); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+	for _, want := range []string{
+		`<link href="https://example.com/show.atom" rel="self" type="application/atom+xml">`,
+		`<link href="https://example.com/show.xml" rel="alternate" type="application/rss+xml">`,
+		`<subtitle type="html">A &lt;b&gt;show&lt;/b&gt;</subtitle>`,
+		`<id>urn:uuid:bf984bb1-49d1-4468-b5eb-3b4baec0c34c</id>`,
+		`<link href="https://example.com/one.mp3" rel="enclosure" type="audio/mpeg" title="One" length="1234">`,
+		`<published>2020-06-01T10:00:00Z</published>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("EncodeAtom() = %s, want it to contain %s", got, want)
+		}
+	}
+}
+
+func TestAtomID(t *testing.T) {
+	for guid, want := range map[string]string{
+		"https://example.com/ep1":              "https://example.com/ep1",
+		"bf984bb1-49d1-4468-b5eb-3b4baec0c34c": "urn:uuid:bf984bb1-49d1-4468-b5eb-3b4baec0c34c",
+		"old guid 2":                           "tag:example.com,2005:old%20guid%202",
+	} {
+		if got := atomID(guid, "https://example.com/show/"); got != want {
+			t.Errorf("atomID(%q) = %q, want %q", guid, got, want)
+		}
+	}
+}
+
+func TestIsHTML(t *testing.T) {
+	for s, want := range map[string]bool{
+		"<p>Notes</p>":        true,
+		"See <a href=x>x</a>": true,
+		"Line<br/>break":      true,
+		"1 < 2 and 3 > 2":     false,
+		"a <3 b":              false,
+		"":                    false,
+	} {
+		if got := IsHTML(s); got != want {
+			t.Errorf("IsHTML(%q) = %t, want %t", s, got, want)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package podcast
+
+import "strings"
+
+// Categories is the list of Apple Podcasts categories, and their
+// subcategories, documented in AddCategory.
+//
+// See https://podcasters.apple.com/support/1691-apple-podcasts-categories
+var Categories = []struct {
+	Name          string
+	Subcategories []string
+}{
+	{"Arts", []string{
+		"Books",
+		"Design",
+		"Fashion & Beauty",
+		"Food",
+		"Performing Arts",
+		"Visual Arts",
+	}},
+	{"Business", []string{
+		"Careers",
+		"Entrepreneurship",
+		"Investing",
+		"Management",
+		"Marketing",
+		"Non-Profit",
+	}},
+	{"Comedy", []string{
+		"Comedy Interviews",
+		"Improv",
+		"Stand-Up",
+	}},
+	{"Education", []string{
+		"Courses",
+		"How To",
+		"Language Learning",
+		"Self-Improvement",
+	}},
+	{"Fiction", []string{
+		"Comedy Fiction",
+		"Drama",
+		"Science Fiction",
+	}},
+	{"Government", nil},
+	{"History", nil},
+	{"Health & Fitness", []string{
+		"Alternative Health",
+		"Fitness",
+		"Medicine",
+		"Mental Health",
+		"Nutrition",
+		"Sexuality",
+	}},
+	{"Kids & Family", []string{
+		"Education for Kids",
+		"Parenting",
+		"Pets & Animals",
+		"Stories for Kids",
+	}},
+	{"Leisure", []string{
+		"Animation & Manga",
+		"Automotive",
+		"Aviation",
+		"Crafts",
+		"Games",
+		"Hobbies",
+		"Home & Garden",
+		"Video Games",
+	}},
+	{"Music", []string{
+		"Music Commentary",
+		"Music History",
+		"Music Interviews",
+	}},
+	{"News", []string{
+		"Business News",
+		"Daily News",
+		"Entertainment News",
+		"News Commentary",
+		"Politics",
+		"Sports News",
+		"Tech News",
+	}},
+	{"Religion & Spirituality", []string{
+		"Buddhism",
+		"Christianity",
+		"Hinduism",
+		"Islam",
+		"Judaism",
+		"Religion",
+		"Spirituality",
+	}},
+	{"Science", []string{
+		"Astronomy",
+		"Chemistry",
+		"Earth Sciences",
+		"Life Sciences",
+		"Mathematics",
+		"Natural Sciences",
+		"Nature",
+		"Physics",
+		"Social Sciences",
+	}},
+	{"Society & Culture", []string{
+		"Documentary",
+		"Personal Journals",
+		"Philosophy",
+		"Places & Travel",
+		"Relationships",
+	}},
+	{"Sports", []string{
+		"Baseball",
+		"Basketball",
+		"Cricket",
+		"Fantasy Sports",
+		"Football",
+		"Golf",
+		"Hockey",
+		"Rugby",
+		"Running",
+		"Soccer",
+		"Swimming",
+		"Tennis",
+		"Volleyball",
+		"Wilderness",
+		"Wrestling",
+	}},
+	{"Technology", nil},
+	{"True Crime", nil},
+	{"TV & Film", []string{
+		"After Shows",
+		"Film History",
+		"Film Interviews",
+		"Film Reviews",
+		"TV Reviews",
+	}},
+}
+
+// ValidCategory returns true if category, and subcategory, if it is not
+// empty, are in Categories.
+func ValidCategory(category string, subcategory string) bool {
+	for _, c := range Categories {
+		if c.Name != category {
+			continue
+		}
+		if subcategory == "" {
+			return true
+		}
+		for _, s := range c.Subcategories {
+			if s == subcategory {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// SuggestCategory returns the category in Categories closest to category,
+// or, if subcategory is not empty, the closest of category's subcategories
+// to subcategory. It returns "" if none are close.
+func SuggestCategory(category string, subcategory string) string {
+	var names []string
+	name := category
+	for _, c := range Categories {
+		if subcategory == "" {
+			names = append(names, c.Name)
+		} else if c.Name == category {
+			names = c.Subcategories
+			name = subcategory
+		}
+	}
+
+	rv := ""
+	// allow about one typo for every three characters
+	best := len(name)/3 + 1
+	for _, n := range names {
+		d := editDistance(strings.ToLower(name), strings.ToLower(n))
+		if d < best {
+			best = d
+			rv = n
+		}
+	}
+	return rv
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	row := make([]int, len(rb)+1)
+	for j := range row {
+		row[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		prev := row[0]
+		row[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur := row[j]
+			row[j] = min3(row[j]+1, row[j-1]+1, prev+cost)
+			prev = cur
+		}
+	}
+	return row[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,313 @@
+package podcast
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The structs in this package use literal "itunes:" and "podcast:" prefixes,
+// which encoding/xml does not resolve to namespaces when decoding, so feeds
+// are decoded into the structs below, and then copied into a Podcast.
+
+type decodeRSS struct {
+	XMLName xml.Name      `xml:"rss"`
+	Channel decodeChannel `xml:"channel"`
+}
+
+type decodeChannel struct {
+	// namespaced fields come first, as encoding/xml matches fields without a
+	// namespace to elements in any namespace, and uses the first match
+	AtomLinks []struct {
+		HREF string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+		Type string `xml:"type,attr"`
+	} `xml:"http://www.w3.org/2005/Atom link"`
+
+	IAuthor     string           `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd author"`
+	ISubtitle   string           `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd subtitle"`
+	ISummary    *string          `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd summary"`
+	IBlock      string           `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd block"`
+	IImage      *decodeHREF      `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image"`
+	IDuration   string           `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd duration"`
+	IExplicit   string           `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd explicit"`
+	IComplete   string           `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd complete"`
+	INewFeedURL string           `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd new-feed-url"`
+	IOwner      *decodeOwner     `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd owner"`
+	ICategories []decodeCategory `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd category"`
+
+	PGUID   string `xml:"https://podcastindex.org/namespace/1.0 guid"`
+	PLocked *struct {
+		Owner string `xml:"owner,attr"`
+		Text  string `xml:",chardata"`
+	} `xml:"https://podcastindex.org/namespace/1.0 locked"`
+	PFunding []struct {
+		URL  string `xml:"url,attr"`
+		Text string `xml:",chardata"`
+	} `xml:"https://podcastindex.org/namespace/1.0 funding"`
+	PLicense *struct {
+		URL  string `xml:"url,attr"`
+		Text string `xml:",chardata"`
+	} `xml:"https://podcastindex.org/namespace/1.0 license"`
+	PLocation *struct {
+		Geo  string `xml:"geo,attr"`
+		OSM  string `xml:"osm,attr"`
+		Text string `xml:",chardata"`
+	} `xml:"https://podcastindex.org/namespace/1.0 location"`
+
+	Title          string   `xml:"title"`
+	Link           string   `xml:"link"`
+	Description    string   `xml:"description"`
+	Categories     []string `xml:"category"`
+	Cloud          string   `xml:"cloud"`
+	Copyright      string   `xml:"copyright"`
+	Docs           string   `xml:"docs"`
+	Generator      string   `xml:"generator"`
+	Language       string   `xml:"language"`
+	LastBuildDate  string   `xml:"lastBuildDate"`
+	ManagingEditor string   `xml:"managingEditor"`
+	PubDate        string   `xml:"pubDate"`
+	Rating         string   `xml:"rating"`
+	SkipHours      string   `xml:"skipHours"`
+	SkipDays       string   `xml:"skipDays"`
+	TTL            int      `xml:"ttl"`
+	WebMaster      string   `xml:"webMaster"`
+	Image          *Image   `xml:"image"`
+
+	Items []decodeItem `xml:"item"`
+}
+
+type decodeHREF struct {
+	HREF string `xml:"href,attr"`
+}
+
+type decodeOwner struct {
+	Name  string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd name"`
+	Email string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd email"`
+}
+
+type decodeCategory struct {
+	Text        string           `xml:"text,attr"`
+	ICategories []decodeCategory `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd category"`
+}
+
+type decodeItem struct {
+	IAuthor            string      `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd author"`
+	ISubtitle          string      `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd subtitle"`
+	ISummary           *string     `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd summary"`
+	IImage             *decodeHREF `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image"`
+	IDuration          string      `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd duration"`
+	IExplicit          string      `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd explicit"`
+	IIsClosedCaptioned string      `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd isClosedCaptioned"`
+	IOrder             string      `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd order"`
+	ITitle             string      `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd title"`
+	ISeason            string      `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd season"`
+	IEpisode           string      `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd episode"`
+	IEpisodeType       string      `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd episodeType"`
+
+	PTranscripts []struct {
+		URL      string `xml:"url,attr"`
+		Type     string `xml:"type,attr"`
+		Language string `xml:"language,attr"`
+		Rel      string `xml:"rel,attr"`
+	} `xml:"https://podcastindex.org/namespace/1.0 transcript"`
+	PChapters *struct {
+		URL  string `xml:"url,attr"`
+		Type string `xml:"type,attr"`
+	} `xml:"https://podcastindex.org/namespace/1.0 chapters"`
+	PPersons []struct {
+		Role  string `xml:"role,attr"`
+		Group string `xml:"group,attr"`
+		Img   string `xml:"img,attr"`
+		HREF  string `xml:"href,attr"`
+		Text  string `xml:",chardata"`
+	} `xml:"https://podcastindex.org/namespace/1.0 person"`
+	PSeason *struct {
+		Name   string `xml:"name,attr"`
+		Number string `xml:",chardata"`
+	} `xml:"https://podcastindex.org/namespace/1.0 season"`
+	PEpisode *struct {
+		Display string `xml:"display,attr"`
+		Number  string `xml:",chardata"`
+	} `xml:"https://podcastindex.org/namespace/1.0 episode"`
+
+	GUID *struct {
+		Text        string `xml:",chardata"`
+		IsPermaLink string `xml:"isPermaLink,attr"`
+	} `xml:"guid"`
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	Description string `xml:"description"`
+	Author      string `xml:"author"`
+	Category    string `xml:"category"`
+	Comments    string `xml:"comments"`
+	Source      string `xml:"source"`
+	PubDate     string `xml:"pubDate"`
+	Enclosure   *struct {
+		URL    string `xml:"url,attr"`
+		Length string `xml:"length,attr"`
+		Type   string `xml:"type,attr"`
+	} `xml:"enclosure"`
+}
+
+// ParseEnclosureType returns the EnclosureType of the MIME type, and
+// false if it is not one of the EnclosureTypes. Apple Podcasts supports
+// all of them but AAC.
+func ParseEnclosureType(mimeType string) (EnclosureType, bool) {
+	for _, et := range []EnclosureType{M4A, M4V, MP4, MP3, MOV, PDF, EPUB, AAC} {
+		if strings.EqualFold(et.String(), mimeType) {
+			return et, true
+		}
+	}
+	return MP3, false
+}
+
+// Decode reads an RSS 2.0 feed, with itunes: and podcast: extensions,
+// from r. Values are copied as-is, without the defaults and validation
+// that New, AddItem, etc. apply.
+func Decode(r io.Reader) (*Podcast, error) {
+	var rss decodeRSS
+	err := xml.NewDecoder(r).Decode(&rss)
+	if err != nil {
+		return nil, err
+	}
+	c := &rss.Channel
+
+	p := &Podcast{
+		Title:          c.Title,
+		Link:           c.Link,
+		Description:    c.Description,
+		Category:       strings.Join(c.Categories, ","),
+		Cloud:          c.Cloud,
+		Copyright:      c.Copyright,
+		Docs:           c.Docs,
+		Generator:      c.Generator,
+		Language:       c.Language,
+		LastBuildDate:  c.LastBuildDate,
+		ManagingEditor: c.ManagingEditor,
+		PubDate:        c.PubDate,
+		Rating:         c.Rating,
+		SkipHours:      c.SkipHours,
+		SkipDays:       c.SkipDays,
+		TTL:            c.TTL,
+		WebMaster:      c.WebMaster,
+		Image:          c.Image,
+		IAuthor:        c.IAuthor,
+		ISubtitle:      c.ISubtitle,
+		IBlock:         c.IBlock,
+		IDuration:      c.IDuration,
+		IExplicit:      c.IExplicit,
+		IComplete:      c.IComplete,
+		INewFeedURL:    c.INewFeedURL,
+		PGUID:          c.PGUID,
+		encode:         encoder,
+	}
+	for _, l := range c.AtomLinks {
+		if l.Rel == "self" {
+			p.AtomLink = &AtomLink{HREF: l.HREF, Rel: l.Rel, Type: l.Type}
+		}
+	}
+	if c.ISummary != nil {
+		p.ISummary = &ISummary{Text: *c.ISummary}
+	}
+	if c.IImage != nil {
+		p.IImage = &IImage{HREF: c.IImage.HREF}
+	}
+	if c.IOwner != nil {
+		p.IOwner = &Author{Name: c.IOwner.Name, Email: c.IOwner.Email}
+	}
+	p.ICategories = decodeCategories(c.ICategories)
+	if c.PLocked != nil {
+		p.PLocked = &PLocked{Owner: c.PLocked.Owner, Text: c.PLocked.Text}
+	}
+	for _, f := range c.PFunding {
+		p.PFunding = append(p.PFunding, &PFunding{URL: f.URL, Text: f.Text})
+	}
+	if c.PLicense != nil {
+		p.PLicense = &PLicense{URL: c.PLicense.URL, Text: c.PLicense.Text}
+	}
+	if c.PLocation != nil {
+		p.PLocation = &PLocation{Geo: c.PLocation.Geo, OSM: c.PLocation.OSM, Text: c.PLocation.Text}
+	}
+
+	for j := range c.Items {
+		p.Items = append(p.Items, decodeItemFrom(&c.Items[j]))
+	}
+	return p, nil
+}
+
+func decodeCategories(categories []decodeCategory) (rv []*ICategory) {
+	for _, c := range categories {
+		rv = append(rv, &ICategory{Text: c.Text, ICategories: decodeCategories(c.ICategories)})
+	}
+	return rv
+}
+
+func decodeItemFrom(d *decodeItem) *Item {
+	i := &Item{
+		Title:              d.Title,
+		Link:               d.Link,
+		Description:        d.Description,
+		AuthorFormatted:    d.Author,
+		Category:           d.Category,
+		Comments:           d.Comments,
+		Source:             d.Source,
+		PubDateFormatted:   d.PubDate,
+		IAuthor:            d.IAuthor,
+		ISubtitle:          d.ISubtitle,
+		IDuration:          d.IDuration,
+		IExplicit:          d.IExplicit,
+		IIsClosedCaptioned: d.IIsClosedCaptioned,
+		IOrder:             d.IOrder,
+		ITitle:             d.ITitle,
+		ISeason:            d.ISeason,
+		IEpisode:           d.IEpisode,
+		IEpisodeType:       d.IEpisodeType,
+	}
+	if d.GUID != nil {
+		i.GUID = d.GUID.Text
+		i.GUIDFormatted = &GUID{Text: d.GUID.Text, IsPermaLink: d.GUID.IsPermaLink}
+	}
+	for _, layout := range []string{time.RFC1123Z, time.RFC1123} {
+		t, err := time.Parse(layout, d.PubDate)
+		if err == nil {
+			i.PubDate = &t
+			break
+		}
+	}
+	if d.Enclosure != nil {
+		e := &Enclosure{
+			URL:             d.Enclosure.URL,
+			LengthFormatted: d.Enclosure.Length,
+			TypeFormatted:   d.Enclosure.Type,
+		}
+		e.Length, _ = strconv.ParseInt(d.Enclosure.Length, 10, 64)
+		e.Type, _ = ParseEnclosureType(d.Enclosure.Type)
+		i.Enclosure = e
+	}
+	if d.ISummary != nil {
+		i.ISummary = &ISummary{Text: *d.ISummary}
+	}
+	if d.IImage != nil {
+		i.IImage = &IImage{HREF: d.IImage.HREF}
+	}
+	for _, t := range d.PTranscripts {
+		i.PTranscripts = append(i.PTranscripts, &PTranscript{URL: t.URL, Type: t.Type, Language: t.Language, Rel: t.Rel})
+	}
+	if d.PChapters != nil {
+		i.PChapters = &PChapters{URL: d.PChapters.URL, Type: d.PChapters.Type}
+	}
+	for _, p := range d.PPersons {
+		i.PPersons = append(i.PPersons, &PPerson{Role: p.Role, Group: p.Group, Img: p.Img, HREF: p.HREF, Text: p.Text})
+	}
+	if d.PSeason != nil {
+		number, _ := strconv.Atoi(strings.TrimSpace(d.PSeason.Number))
+		i.PSeason = &PSeason{Name: d.PSeason.Name, Number: number}
+	}
+	if d.PEpisode != nil {
+		i.PEpisode = &PEpisode{Display: d.PEpisode.Display, Number: strings.TrimSpace(d.PEpisode.Number)}
+	}
+	return i
+}
@@ -0,0 +1,92 @@
+package podcast
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// decodeTestPodcast returns a podcast that uses most of the elements Decode reads
+func decodeTestPodcast(t *testing.T) *Podcast {
+	pubDate := time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC)
+	p := New("Show & Tell", "https://example.com/", "A <b>show</b>", &pubDate, &pubDate)
+	p.AddAuthor("Jane Doe", "jane@example.com")
+	p.AddAtomLink("https://example.com/show.xml")
+	p.AddCategory("Education", []string{"Courses"})
+	p.AddImage("https://example.com/show.jpg")
+	p.AddSubTitle("The subtitle")
+	p.AddSummary("The <i>summary</i>")
+	p.AddPodcastGUID("https://example.com/show.xml")
+	p.AddFunding("https://example.com/donate", "Support the show")
+	p.Copyright = "2020 Jane Doe"
+	p.Language = "en-us"
+	p.IExplicit = "false"
+	p.IComplete = "Yes"
+	p.PLocked = &PLocked{Owner: "jane@example.com", Text: "yes"}
+	p.PLicense = &PLicense{Text: "cc-by-4.0"}
+	p.PLocation = &PLocation{Geo: "geo:30.2672,97.7431", Text: "Austin, TX"}
+
+	for n, title := range []string{"One", "Two"} {
+		date := pubDate.AddDate(0, 0, n)
+		item := Item{
+			Title:       title,
+			Description: "<p>Episode " + title + "</p>",
+			GUID:        "guid-" + title,
+			IExplicit:   "false",
+			ISeason:     "1",
+			IEpisode:    title,
+		}
+		item.AddPubDate(&date)
+		item.AddEnclosure("https://example.com/"+title+".m4a", M4A, int64(1000+n))
+		item.AddImage("https://example.com/" + title + ".jpg")
+		item.AddSummary("Summary of " + title)
+		item.AddDuration(int64(3600 + n))
+		item.AddTranscript("https://example.com/"+title+".vtt", "text/vtt", "en")
+		item.AddChapters("https://example.com/" + title + ".json")
+		item.AddPerson("Jane Doe", "host")
+		item.AddSeason(1, "First")
+		item.AddEpisode("1.5")
+		if _, err := p.AddItem(item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &p
+}
+
+func TestDecodeRoundTrip(t *testing.T) {
+	var want bytes.Buffer
+	if err := decodeTestPodcast(t).Encode(&want); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := Decode(bytes.NewReader(want.Bytes()))
+	if err != nil {
+		t.Fatalf("Decode() failed: %s", err)
+	}
+	var got bytes.Buffer
+	if err := p.Encode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != want.String() {
+		t.Errorf("Encode(Decode(feed)) =\n%s\nwant\n%s", got.String(), want.String())
+	}
+
+	if len(p.Items) != 2 {
+		t.Fatalf("Decode() returned %d items, want 2", len(p.Items))
+	}
+	tests := []struct {
+		name, got, want string
+	}{
+		{"title", p.Title, "Show & Tell"},
+		{"itunes:author", p.IAuthor, "jane@example.com (Jane Doe)"},
+		{"podcast:guid", p.PGUID, uuidV5(podcastGUIDNamespace, "example.com/show.xml")},
+		{"item guid", p.Items[0].GUID, "guid-One"},
+		{"item enclosure type", p.Items[1].Enclosure.Type.String(), "audio/x-m4a"},
+		{"item duration", p.Items[1].IDuration, "1:00:01"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("Decode(): %s = %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+}
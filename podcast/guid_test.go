@@ -0,0 +1,46 @@
+package podcast
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGUIDIsPermaLink(t *testing.T) {
+	tests := []struct {
+		guid string
+		want string
+	}{
+		{"bf984bb1-49d1-4468-b5eb-3b4baec0c34c", `<guid isPermaLink="false">bf984bb1-49d1-4468-b5eb-3b4baec0c34c</guid>`},
+		{"urn:uuid:bf984bb1-49d1-4468-b5eb-3b4baec0c34c", `<guid isPermaLink="false">urn:uuid:bf984bb1-49d1-4468-b5eb-3b4baec0c34c</guid>`},
+		{"one.mp3", `<guid isPermaLink="false">one.mp3</guid>`},
+		{"https://example.com/one.mp3", `<guid>https://example.com/one.mp3</guid>`},
+		// no guid: the enclosure's URL
+		{"", `<guid>https://example.com/one.mp3</guid>`},
+	}
+	pubDate := time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		var outputs []string
+		// the output must not change from run to run
+		for run := 0; run < 2; run++ {
+			p := New("Show", "https://example.com/", "A show", &pubDate, &pubDate)
+			item := Item{Title: "One", Description: "First", PubDate: &pubDate, GUID: tt.guid}
+			item.AddEnclosure("https://example.com/one.mp3", MP3, 1234)
+			if _, err := p.AddItem(item); err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := p.Encode(&buf); err != nil {
+				t.Fatal(err)
+			}
+			outputs = append(outputs, buf.String())
+		}
+		if !strings.Contains(outputs[0], tt.want) {
+			t.Errorf("Encode() of GUID %q = %s, want it to contain %s", tt.guid, outputs[0], tt.want)
+		}
+		if outputs[0] != outputs[1] {
+			t.Errorf("Encode() of GUID %q is not stable:\n%s\n%s", tt.guid, outputs[0], outputs[1])
+		}
+	}
+}
@@ -25,7 +25,8 @@ import (
 // - Use Enclosure.Type instead of setting TypeFormatted for valid extensions.
 type Item struct {
 	XMLName          xml.Name   `xml:"item"`
-	GUID             string     `xml:"guid"`
+	GUID             string     `xml:"-"`
+	GUIDFormatted    *GUID      `xml:"guid"`
 	Title            string     `xml:"title"`
 	Link             string     `xml:"link"`
 	Description      string     `xml:"description"`
@@ -36,17 +37,38 @@ type Item struct {
 	Source           string     `xml:"source,omitempty"`
 	PubDate          *time.Time `xml:"-"`
 	PubDateFormatted string     `xml:"pubDate,omitempty"`
-	Enclosure        *Enclosure
+	Enclosure        *Enclosure `xml:"enclosure"`
 
 	// https://help.apple.com/itc/podcasts_connect/#/itcb54353390
-	IAuthor            string `xml:"iauthor,omitempty"`
-	ISubtitle          string `xml:"subtitle,omitempty"`
-	ISummary           *ISummary
-	IImage             *IImage
-	IDuration          string `xml:"duration,omitempty"`
-	IExplicit          string `xml:"explicit,omitempty"`
-	IIsClosedCaptioned string `xml:"isClosedCaptioned,omitempty"`
-	IOrder             string `xml:"order,omitempty"`
+	IAuthor            string    `xml:"itunes:author,omitempty"`
+	ISubtitle          string    `xml:"itunes:subtitle,omitempty"`
+	ISummary           *ISummary `xml:"itunes:summary"`
+	IImage             *IImage   `xml:"itunes:image"`
+	IDuration          string    `xml:"itunes:duration,omitempty"`
+	IExplicit          string    `xml:"itunes:explicit,omitempty"`
+	IIsClosedCaptioned string    `xml:"itunes:isClosedCaptioned,omitempty"`
+	IOrder             string    `xml:"itunes:order,omitempty"`
+	ITitle             string    `xml:"itunes:title,omitempty"`
+	ISeason            string    `xml:"itunes:season,omitempty"`
+	IEpisode           string    `xml:"itunes:episode,omitempty"`
+	IEpisodeType       string    `xml:"itunes:episodeType,omitempty"`
+
+	// https://github.com/Podcastindex-org/podcast-namespace/blob/main/docs/1.0.md
+	PTranscripts []*PTranscript `xml:"podcast:transcript"`
+	PChapters    *PChapters     `xml:"podcast:chapters"`
+	PPersons     []*PPerson     `xml:"podcast:person"`
+	PSeason      *PSeason       `xml:"podcast:season"`
+	PEpisode     *PEpisode      `xml:"podcast:episode"`
+}
+
+// GUID represents the globally unique identifier of an Item.
+//
+// IsPermaLink is "false" when the GUID is not a URL that can be opened
+// in a web browser.
+type GUID struct {
+	XMLName     xml.Name `xml:"guid"`
+	Text        string   `xml:",chardata"`
+	IsPermaLink string   `xml:"isPermaLink,attr,omitempty"`
 }
 
 // AddEnclosure adds the downloadable asset to the podcast Item.
@@ -7,9 +7,9 @@ import "encoding/xml"
 
 // ICategory is a 2-tier classification system for iTunes.
 type ICategory struct {
-	XMLName     xml.Name `xml:"category"`
-	Text        string   `xml:"text,attr"`
-	ICategories []*ICategory
+	XMLName     xml.Name     `xml:"itunes:category"`
+	Text        string       `xml:"text,attr"`
+	ICategories []*ICategory `xml:"itunes:category"`
 }
 
 // IImage represents an iTunes image.
@@ -21,7 +21,7 @@ type ICategory struct {
 // images for mobile devices, Apple recommends compressing your
 // image files.
 type IImage struct {
-	XMLName xml.Name `xml:"image"`
+	XMLName xml.Name `xml:"itunes:image"`
 	HREF    string   `xml:"href,attr"`
 }
 
@@ -29,6 +29,6 @@ type IImage struct {
 //
 // This is rendered as CDATA which allows for HTML tags such as <a href="">.
 type ISummary struct {
-	XMLName xml.Name `xml:"summary"`
+	XMLName xml.Name `xml:"itunes:summary"`
 	Text    string   `xml:",cdata"`
 }
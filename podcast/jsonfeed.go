@@ -0,0 +1,141 @@
+package podcast
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Specifications: https://jsonfeed.org/version/1.1
+//
+
+const jsonFeedVersion = "https://jsonfeed.org/version/1.1"
+
+type jsonFeed struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	HomePageURL string           `json:"home_page_url,omitempty"`
+	FeedURL     string           `json:"feed_url,omitempty"`
+	Description string           `json:"description,omitempty"`
+	Icon        string           `json:"icon,omitempty"`
+	Authors     []jsonFeedAuthor `json:"authors,omitempty"`
+	Language    string           `json:"language,omitempty"`
+	Expired     bool             `json:"expired,omitempty"`
+	Items       []jsonFeedItem   `json:"items"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+type jsonFeedItem struct {
+	ID            string               `json:"id"`
+	URL           string               `json:"url,omitempty"`
+	Title         string               `json:"title,omitempty"`
+	ContentHTML   string               `json:"content_html,omitempty"`
+	ContentText   string               `json:"content_text,omitempty"`
+	Summary       string               `json:"summary,omitempty"`
+	Image         string               `json:"image,omitempty"`
+	DatePublished string               `json:"date_published,omitempty"`
+	Authors       []jsonFeedAuthor     `json:"authors,omitempty"`
+	Attachments   []jsonFeedAttachment `json:"attachments,omitempty"`
+}
+
+type jsonFeedAttachment struct {
+	URL               string `json:"url"`
+	MIMEType          string `json:"mime_type"`
+	Title             string `json:"title,omitempty"`
+	SizeInBytes       int64  `json:"size_in_bytes,omitempty"`
+	DurationInSeconds int64  `json:"duration_in_seconds,omitempty"`
+}
+
+// durationSeconds returns the seconds in an iTunes duration: seconds, M:SS,
+// or H:MM:SS, or 0, if it is not one of those
+func durationSeconds(duration string) int64 {
+	var seconds int64
+	for _, part := range strings.Split(strings.TrimSpace(duration), ":") {
+		n, err := strconv.ParseInt(part, 10, 64)
+		if err != nil || n < 0 {
+			return 0
+		}
+		seconds = seconds*60 + n
+	}
+	return seconds
+}
+
+// EncodeJSON writes the podcast to w as a JSON Feed 1.1, whose URL is
+// feedURL. Each item's enclosure is an attachment, with its size and its
+// duration, and each item's id is its GUID.
+func (p *Podcast) EncodeJSON(w io.Writer, feedURL string) error {
+	f := jsonFeed{
+		Version:     jsonFeedVersion,
+		Title:       p.Title,
+		HomePageURL: p.Link,
+		FeedURL:     feedURL,
+		Description: p.Description,
+		Language:    p.Language,
+		Expired:     strings.EqualFold(p.IComplete, "yes"),
+		Items:       []jsonFeedItem{},
+	}
+	if p.IImage != nil {
+		f.Icon = p.IImage.HREF
+	} else if p.Image != nil {
+		f.Icon = p.Image.URL
+	}
+
+	author := p.IAuthor
+	if author == "" && p.IOwner != nil {
+		author = p.IOwner.Name
+	}
+	if author != "" {
+		f.Authors = []jsonFeedAuthor{{Name: author}}
+	}
+
+	for _, i := range p.Items {
+		item := jsonFeedItem{
+			ID:      i.GUID,
+			URL:     i.Link,
+			Title:   i.Title,
+			Summary: i.ISubtitle,
+		}
+		if IsHTML(i.Description) {
+			item.ContentHTML = i.Description
+		} else {
+			item.ContentText = i.Description
+		}
+		if item.ContentHTML == "" && item.ContentText == "" {
+			// an item must have content_html or content_text
+			item.ContentText = i.Title
+		}
+		if i.IImage != nil {
+			item.Image = i.IImage.HREF
+		}
+		if i.PubDate != nil {
+			item.DatePublished = i.PubDate.Format(time.RFC3339)
+		}
+		if i.IAuthor != "" && i.IAuthor != author {
+			item.Authors = []jsonFeedAuthor{{Name: i.IAuthor}}
+		}
+		if i.Enclosure != nil {
+			mimeType := i.Enclosure.TypeFormatted
+			if mimeType == "" {
+				mimeType = i.Enclosure.Type.String()
+			}
+			item.Attachments = []jsonFeedAttachment{{
+				URL:               i.Enclosure.URL,
+				MIMEType:          mimeType,
+				Title:             i.Title,
+				SizeInBytes:       i.Enclosure.Length,
+				DurationInSeconds: durationSeconds(i.IDuration),
+			}}
+		}
+		f.Items = append(f.Items, item)
+	}
+
+	e := json.NewEncoder(w)
+	e.SetEscapeHTML(false)
+	e.SetIndent("", "  ")
+	return e.Encode(f)
+}
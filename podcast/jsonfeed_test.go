@@ -0,0 +1,52 @@
+package podcast
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncodeJSON(t *testing.T) {
+	pubDate := time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC)
+	p := New("Show", "https://example.com/", "A show", &pubDate, &pubDate)
+	item := Item{Title: "One", Description: "<p>First</p>", PubDate: &pubDate, IDuration: "1:02:03"}
+	item.AddEnclosure("https://example.com/one.mp3", MP3, 1234)
+	if _, err := p.AddItem(item); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := p.EncodeJSON(&buf, "https://example.com/show.json"); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+	for _, want := range []string{
+		`"version": "https://jsonfeed.org/version/1.1"`,
+		`"feed_url": "https://example.com/show.json"`,
+		`"id": "https://example.com/one.mp3"`,
+		`"content_html": "<p>First</p>"`,
+		`"date_published": "2020-06-01T10:00:00Z"`,
+		`"mime_type": "audio/mpeg"`,
+		`"size_in_bytes": 1234`,
+		`"duration_in_seconds": 3723`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("EncodeJSON() = %s, want it to contain %s", got, want)
+		}
+	}
+}
+
+func TestDurationSeconds(t *testing.T) {
+	for duration, want := range map[string]int64{
+		"":        0,
+		"95":      95,
+		"1:35":    95,
+		"1:01:35": 3695,
+		"1:xx":    0,
+	} {
+		if got := durationSeconds(duration); got != want {
+			t.Errorf("durationSeconds(%q) = %d, want %d", duration, got, want)
+		}
+	}
+}
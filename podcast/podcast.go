@@ -5,6 +5,7 @@ import (
 	"encoding/xml"
 	"fmt"
 	"io"
+	"net/url"
 	"strconv"
 	"time"
 	"unicode/utf8"
@@ -22,7 +23,7 @@ type Podcast struct {
 	Title          string   `xml:"title"`
 	Link           string   `xml:"link"`
 	Description    string   `xml:"description"`
-	Category       string   `xml:"category,omitempty"`
+	Category       string   `xml:"category,omitempty" yaml:"-"` // set via AddCategory
 	Cloud          string   `xml:"cloud,omitempty"`
 	Copyright      string   `xml:"copyright,omitempty"`
 	Docs           string   `xml:"docs,omitempty"`
@@ -41,19 +42,26 @@ type Podcast struct {
 	AtomLink       *AtomLink
 
 	// https://help.apple.com/itc/podcasts_connect/#/itcb54353390
-	IAuthor     string `xml:"author,omitempty"`
-	ISubtitle   string `xml:"subtitle,omitempty"`
-	ISummary    *ISummary
-	IBlock      string `xml:"block,omitempty"`
-	IImage      *IImage
-	IDuration   string  `xml:"duration,omitempty"`
-	IExplicit   string  `xml:"explicit,omitempty"`
-	IComplete   string  `xml:"complete,omitempty"`
-	INewFeedURL string  `xml:"new-feed-url,omitempty"`
-	IOwner      *Author // Author is formatted for itunes as-is
-	ICategories []*ICategory
-
-	Items []*Item
+	IAuthor     string       `xml:"itunes:author,omitempty"`
+	ISubtitle   string       `xml:"itunes:subtitle,omitempty"`
+	ISummary    *ISummary    `xml:"itunes:summary"`
+	IBlock      string       `xml:"itunes:block,omitempty"`
+	IImage      *IImage      `xml:"itunes:image"`
+	IDuration   string       `xml:"itunes:duration,omitempty"`
+	IExplicit   string       `xml:"itunes:explicit,omitempty"`
+	IComplete   string       `xml:"itunes:complete,omitempty"`
+	INewFeedURL string       `xml:"itunes:new-feed-url,omitempty"`
+	IOwner      *Author      `xml:"itunes:owner"` // Author is formatted for itunes as-is
+	ICategories []*ICategory `xml:"itunes:category"`
+
+	// https://github.com/Podcastindex-org/podcast-namespace/blob/main/docs/1.0.md
+	PGUID     string      `xml:"podcast:guid,omitempty"`
+	PLocked   *PLocked    `xml:"podcast:locked"`
+	PFunding  []*PFunding `xml:"podcast:funding"`
+	PLicense  *PLicense   `xml:"podcast:license"`
+	PLocation *PLocation  `xml:"podcast:location"`
+
+	Items []*Item `xml:"item"`
 
 	encode func(w io.Writer, o interface{}) error
 }
@@ -110,76 +118,119 @@ func (p *Podcast) AddAtomLink(href string) {
 // list, if any, including ICategory.
 //
 // Note that Apple iTunes has a specific list of categories that only can be
-// used and will invalidate the feed if deviated from the list.  That list is
-// as follows.
+// used and will invalidate the feed if deviated from the list.  That list,
+// also available as Categories, is as follows.
 //
 // Arts
+// * Books
 // * Design
 // * Fashion & Beauty
 // * Food
-// * Literature
 // * Performing Arts
 // * Visual Arts
 // Business
-// * Business News
 // * Careers
+// * Entrepreneurship
 // * Investing
-// * Management & Marketing
-// * Shopping
+// * Management
+// * Marketing
+// * Non-Profit
 // Comedy
+// * Comedy Interviews
+// * Improv
+// * Stand-Up
 // Education
-// * Education Technology
-// * Higher Education
-// * K-12
-// * Language Courses
-// * Training
-// Games & Hobbies
+// * Courses
+// * How To
+// * Language Learning
+// * Self-Improvement
+// Fiction
+// * Comedy Fiction
+// * Drama
+// * Science Fiction
+// Government
+// History
+// Health & Fitness
+// * Alternative Health
+// * Fitness
+// * Medicine
+// * Mental Health
+// * Nutrition
+// * Sexuality
+// Kids & Family
+// * Education for Kids
+// * Parenting
+// * Pets & Animals
+// * Stories for Kids
+// Leisure
+// * Animation & Manga
 // * Automotive
 // * Aviation
+// * Crafts
+// * Games
 // * Hobbies
-// * Other Games
+// * Home & Garden
 // * Video Games
-// Government & Organizations
-// * Local
-// * National
-// * Non-Profit
-// * Regional
-// Health
-// * Alternative Health
-// * Fitness & Nutrition
-// * Self-Help
-// * Sexuality
-// Kids & Family
 // Music
-// News & Politics
+// * Music Commentary
+// * Music History
+// * Music Interviews
+// News
+// * Business News
+// * Daily News
+// * Entertainment News
+// * News Commentary
+// * Politics
+// * Sports News
+// * Tech News
 // Religion & Spirituality
 // * Buddhism
 // * Christianity
 // * Hinduism
 // * Islam
 // * Judaism
-// * Other
+// * Religion
 // * Spirituality
-// Science & Medicine
-// * Medicine
+// Science
+// * Astronomy
+// * Chemistry
+// * Earth Sciences
+// * Life Sciences
+// * Mathematics
 // * Natural Sciences
+// * Nature
+// * Physics
 // * Social Sciences
 // Society & Culture
-// * History
+// * Documentary
 // * Personal Journals
 // * Philosophy
 // * Places & Travel
-// Sports & Recreation
-// * Amateur
-// * College & High School
-// * Outdoor
-// * Professional
+// * Relationships
+// Sports
+// * Baseball
+// * Basketball
+// * Cricket
+// * Fantasy Sports
+// * Football
+// * Golf
+// * Hockey
+// * Rugby
+// * Running
+// * Soccer
+// * Swimming
+// * Tennis
+// * Volleyball
+// * Wilderness
+// * Wrestling
 // Technology
-// * Gadgets
-// * Podcasting
-// * Software How-To
-// * Tech News
+// True Crime
 // TV & Film
+// * After Shows
+// * Film History
+// * Film Interviews
+// * Film Reviews
+// * TV Reviews
 func (p *Podcast) AddCategory(category string, subCategories []string) {
 	if len(category) == 0 {
 		return
@@ -249,7 +300,7 @@ func (p *Podcast) AddImage(url string) {
 //
 // The following fields are always overwritten (don't set them):
 //
-// * GUID
+// * GUIDFormatted
 // * PubDateFormatted
 // * AuthorFormatted
 // * Enclosure.TypeFormatted
@@ -288,7 +339,9 @@ func (p *Podcast) AddItem(i Item) (int, error) {
 	i.PubDateFormatted = parseDateRFC1123Z(i.PubDate)
 	i.AuthorFormatted = parseAuthorNameEmail(i.Author)
 	if i.Enclosure != nil {
-		i.GUID = i.Enclosure.URL // yep, GUID is the Permlink URL
+		if len(i.GUID) == 0 {
+			i.GUID = i.Enclosure.URL // yep, GUID is the Permlink URL
+		}
 
 		if i.Enclosure.Length < 0 {
 			i.Enclosure.Length = 0
@@ -301,9 +354,10 @@ func (p *Podcast) AddItem(i Item) (int, error) {
 		if len(i.Link) == 0 {
 			i.Link = i.Enclosure.URL
 		}
-	} else {
+	} else if len(i.GUID) == 0 {
 		i.GUID = i.Link // yep, GUID is the Permlink URL
 	}
+	i.GUIDFormatted = parseGUID(i.GUID)
 
 	// iTunes it
 	//
@@ -392,11 +446,16 @@ func (p *Podcast) Encode(w io.Writer) error {
 	if p.AtomLink != nil {
 		atomLink = "http://www.w3.org/2005/Atom"
 	}
+	podcastLink := ""
+	if p.usesPodcastNS() {
+		podcastLink = podcastNS
+	}
 	wrapped := podcastWrapper{
-		ITUNESNS: "http://www.itunes.com/dtds/podcast-1.0.dtd",
-		ATOMNS:   atomLink,
-		Version:  "2.0",
-		Channel:  p,
+		ITUNESNS:  "http://www.itunes.com/dtds/podcast-1.0.dtd",
+		ATOMNS:    atomLink,
+		PODCASTNS: podcastLink,
+		Version:   "2.0",
+		Channel:   p,
 	}
 	return p.encode(w, wrapped)
 }
@@ -421,11 +480,12 @@ func (p *Podcast) String() string {
 // }
 
 type podcastWrapper struct {
-	XMLName  xml.Name `xml:"rss"`
-	Version  string   `xml:"version,attr"`
-	ATOMNS   string   `xml:"xmlns:atom,attr,omitempty"`
-	ITUNESNS string   `xml:"xmlns:itunes,attr"`
-	Channel  *Podcast
+	XMLName   xml.Name `xml:"rss"`
+	Version   string   `xml:"version,attr"`
+	ATOMNS    string   `xml:"xmlns:atom,attr,omitempty"`
+	ITUNESNS  string   `xml:"xmlns:itunes,attr"`
+	PODCASTNS string   `xml:"xmlns:podcast,attr,omitempty"`
+	Channel   *Podcast
 }
 
 var encoder = func(w io.Writer, o interface{}) error {
@@ -444,6 +504,15 @@ var parseDateRFC1123Z = func(t *time.Time) string {
 	return time.Now().UTC().Format(time.RFC1123Z)
 }
 
+var parseGUID = func(guid string) *GUID {
+	g := &GUID{Text: guid}
+	u, err := url.Parse(guid)
+	if err != nil || !u.IsAbs() || u.Host == "" {
+		g.IsPermaLink = "false"
+	}
+	return g
+}
+
 var parseAuthorNameEmail = func(a *Author) string {
 	var author string
 	if a != nil {
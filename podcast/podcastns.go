@@ -0,0 +1,188 @@
+package podcast
+
+import (
+	"crypto/sha1"
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// Specifications: https://github.com/Podcastindex-org/podcast-namespace/blob/main/docs/1.0.md
+//
+
+const (
+	podcastNS = "https://podcastindex.org/namespace/1.0"
+
+	// podcastGUIDNamespace is the UUID namespace used for podcast:guid
+	podcastGUIDNamespace = "ead4c236-bf58-58c6-a2c6-a6b28d128cb6"
+)
+
+// PLocked tells podcast platforms whether they are allowed to import
+// this feed. Text is "yes" or "no".
+type PLocked struct {
+	XMLName xml.Name `xml:"podcast:locked"`
+	Owner   string   `xml:"owner,attr,omitempty"`
+	Text    string   `xml:",chardata"`
+}
+
+// PFunding lists a donation/funding link for the podcast.
+type PFunding struct {
+	XMLName xml.Name `xml:"podcast:funding"`
+	URL     string   `xml:"url,attr"`
+	Text    string   `xml:",chardata"`
+}
+
+// PLicense is the license of the podcast or episode, either an SPDX
+// identifier, or a name with a URL to the license text.
+type PLicense struct {
+	XMLName xml.Name `xml:"podcast:license"`
+	URL     string   `xml:"url,attr,omitempty"`
+	Text    string   `xml:",chardata"`
+}
+
+// PLocation is the location the podcast is about or was recorded in.
+type PLocation struct {
+	XMLName xml.Name `xml:"podcast:location"`
+	Geo     string   `xml:"geo,attr,omitempty"`
+	OSM     string   `xml:"osm,attr,omitempty"`
+	Text    string   `xml:",chardata"`
+}
+
+// PTranscript links to a transcript or closed captions file.
+type PTranscript struct {
+	XMLName  xml.Name `xml:"podcast:transcript"`
+	URL      string   `xml:"url,attr"`
+	Type     string   `xml:"type,attr"`
+	Language string   `xml:"language,attr,omitempty"`
+	Rel      string   `xml:"rel,attr,omitempty"`
+}
+
+// PChapters links to a JSON chapters file.
+type PChapters struct {
+	XMLName xml.Name `xml:"podcast:chapters"`
+	URL     string   `xml:"url,attr"`
+	Type    string   `xml:"type,attr"`
+}
+
+// PPerson is a person of interest to the podcast or episode, such as a
+// host or guest. Role defaults to "host", and Group to "cast".
+type PPerson struct {
+	XMLName xml.Name `xml:"podcast:person"`
+	Role    string   `xml:"role,attr,omitempty"`
+	Group   string   `xml:"group,attr,omitempty"`
+	Img     string   `xml:"img,attr,omitempty"`
+	HREF    string   `xml:"href,attr,omitempty"`
+	Text    string   `xml:",chardata"`
+}
+
+// PSeason is the season the episode belongs to.
+type PSeason struct {
+	XMLName xml.Name `xml:"podcast:season"`
+	Name    string   `xml:"name,attr,omitempty"`
+	Number  int      `xml:",chardata"`
+}
+
+// PEpisode is the episode number, which may be a decimal.
+type PEpisode struct {
+	XMLName xml.Name `xml:"podcast:episode"`
+	Display string   `xml:"display,attr,omitempty"`
+	Number  string   `xml:",chardata"`
+}
+
+// AddPodcastGUID sets podcast:guid to the UUIDv5 of the feed's URL, with the
+// scheme and trailing slashes removed, as the specification requires.
+func (p *Podcast) AddPodcastGUID(feedURL string) {
+	if len(feedURL) == 0 {
+		return
+	}
+	if i := strings.Index(feedURL, "://"); i >= 0 {
+		feedURL = feedURL[i+3:]
+	}
+	feedURL = strings.TrimRight(feedURL, "/")
+	p.PGUID = uuidV5(podcastGUIDNamespace, feedURL)
+}
+
+// AddFunding adds a podcast:funding link.
+func (p *Podcast) AddFunding(url, text string) {
+	if len(url) == 0 {
+		return
+	}
+	p.PFunding = append(p.PFunding, &PFunding{URL: url, Text: text})
+}
+
+// AddTranscript adds a podcast:transcript link to the Item.
+func (i *Item) AddTranscript(url, mimeType, language string) {
+	if len(url) == 0 {
+		return
+	}
+	t := &PTranscript{URL: url, Type: mimeType, Language: language}
+	if mimeType == "application/srt" || mimeType == "text/vtt" {
+		t.Rel = "captions"
+	}
+	i.PTranscripts = append(i.PTranscripts, t)
+}
+
+// AddChapters adds a podcast:chapters link to the Item.
+func (i *Item) AddChapters(url string) {
+	if len(url) == 0 {
+		return
+	}
+	i.PChapters = &PChapters{URL: url, Type: "application/json+chapters"}
+}
+
+// AddPerson adds a podcast:person to the Item.
+func (i *Item) AddPerson(name, role string) {
+	if len(name) == 0 {
+		return
+	}
+	i.PPersons = append(i.PPersons, &PPerson{Text: name, Role: role})
+}
+
+// AddSeason sets the podcast:season of the Item.
+func (i *Item) AddSeason(season int, name string) {
+	if season <= 0 {
+		return
+	}
+	i.PSeason = &PSeason{Number: season, Name: name}
+}
+
+// AddEpisode sets the podcast:episode of the Item.
+func (i *Item) AddEpisode(episode string) {
+	if len(episode) == 0 {
+		return
+	}
+	i.PEpisode = &PEpisode{Number: episode}
+}
+
+// usesPodcastNS returns true if any podcast: elements will be encoded.
+func (p *Podcast) usesPodcastNS() bool {
+	if len(p.PGUID) > 0 || p.PLocked != nil || len(p.PFunding) > 0 ||
+		p.PLicense != nil || p.PLocation != nil {
+		return true
+	}
+	for _, i := range p.Items {
+		if len(i.PTranscripts) > 0 || i.PChapters != nil || len(i.PPersons) > 0 ||
+			i.PSeason != nil || i.PEpisode != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// uuidV5 returns the version 5 (SHA-1) UUID of name in the namespace UUID.
+func uuidV5(namespace, name string) string {
+	var ns []byte
+	hex := strings.Replace(namespace, "-", "", -1)
+	for j := 0; j+2 <= len(hex); j += 2 {
+		var b byte
+		fmt.Sscanf(hex[j:j+2], "%02x", &b)
+		ns = append(ns, b)
+	}
+	h := sha1.New()
+	h.Write(ns)
+	h.Write([]byte(name))
+	u := h.Sum(nil)[:16]
+	u[6] = (u[6] & 0x0f) | 0x50
+	u[8] = (u[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
@@ -0,0 +1,35 @@
+package podcast
+
+import "testing"
+
+func TestUUIDV5(t *testing.T) {
+	tests := []struct {
+		namespace, name string
+		want            string
+	}{
+		// the podcast namespace's example
+		{podcastGUIDNamespace, "mp3s.nashownotes.com/pc20rss.xml", "917393e3-1b1e-5cef-ace4-edaa54e1f810"},
+		// RFC 4122's DNS namespace
+		{"6ba7b810-9dad-11d1-80b4-00c04fd430c8", "python.org", "886313e1-3b8a-5372-9b90-0c9aee199e5d"},
+	}
+	for _, tt := range tests {
+		if got := uuidV5(tt.namespace, tt.name); got != tt.want {
+			t.Errorf("uuidV5(%q, %q) = %q, want %q", tt.namespace, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAddPodcastGUID(t *testing.T) {
+	const want = "917393e3-1b1e-5cef-ace4-edaa54e1f810"
+	for _, feedURL := range []string{
+		"mp3s.nashownotes.com/pc20rss.xml",
+		"https://mp3s.nashownotes.com/pc20rss.xml",
+		"http://mp3s.nashownotes.com/pc20rss.xml/",
+	} {
+		var p Podcast
+		p.AddPodcastGUID(feedURL)
+		if p.PGUID != want {
+			t.Errorf("AddPodcastGUID(%q) = %q, want %q", feedURL, p.PGUID, want)
+		}
+	}
+}
@@ -0,0 +1,458 @@
+package main
+
+// feedster publish: upload output_dir to an S3 compatible bucket (AWS S3, MinIO, etc.)
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	fpodcast "github.com/rasa/feedster/podcast"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	s3Algorithm  = "AWS4-HMAC-SHA256"
+	s3DateFormat = "20060102T150405Z"
+	s3Service    = "s3"
+)
+
+// feedExtensions are the files uploaded last, after the files they refer to
+var feedExtensions = map[string]bool{
+	".atom": true,
+	".xml":  true,
+}
+
+// isFeed returns true if rel, relative to output_dir, is a feed, or a page of
+// the site: the JSON feed is a .json file, like the chapters
+func isFeed(rel string) bool {
+	ext := strings.ToLower(path.Ext(rel))
+	if feedExtensions[ext] || (defaults.site && ext == ".html") {
+		return true
+	}
+	return defaults.JSONFile != "" && rel == path.Base(defaults.JSONFile)
+}
+
+// Publish is the publish section of the .yaml files
+type Publish struct {
+	AccessKeyID       string `yaml:"access_key_id,omitempty"`
+	Bucket            string `yaml:"bucket,omitempty"`
+	Endpoint          string `yaml:"endpoint,omitempty"`
+	FeedCacheControl  string `yaml:"feed_cache_control,omitempty"`
+	MediaCacheControl string `yaml:"media_cache_control,omitempty"`
+	PathStyle         string `yaml:"path_style,omitempty"`
+	Prefix            string `yaml:"prefix,omitempty"`
+	Region            string `yaml:"region,omitempty"`
+	SecretAccessKey   string `yaml:"secret_access_key,omitempty"`
+	pathStyle         bool
+}
+
+// s3Client is a minimal client for the S3 REST API, signing requests with
+// AWS Signature Version 4
+type s3Client struct {
+	endpoint        *url.URL
+	bucket          string
+	region          string
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+	pathStyle       bool
+	client          *http.Client
+}
+
+func newS3Client(p *Publish) *s3Client {
+	if p.Bucket == "" {
+		log.Fatal("No publish bucket defined")
+	}
+	endpoint := p.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", p.Region)
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		log.Fatalf("Cannot parse publish endpoint %q: %v", endpoint, err)
+	}
+
+	c := &s3Client{
+		endpoint:        u,
+		bucket:          p.Bucket,
+		region:          p.Region,
+		accessKeyID:     p.AccessKeyID,
+		secretAccessKey: p.SecretAccessKey,
+		sessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		pathStyle:       p.pathStyle,
+		client:          &http.Client{},
+	}
+	if c.accessKeyID == "" {
+		c.accessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+	if c.secretAccessKey == "" {
+		c.secretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	if c.accessKeyID == "" || c.secretAccessKey == "" {
+		log.Fatal("No publish credentials defined: set access_key_id and secret_access_key, or AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	return c
+}
+
+// objectURL returns the URL of key, or of the bucket, if key is empty
+func (c *s3Client) objectURL(key string) *url.URL {
+	u := *c.endpoint
+	p := "/" + key
+	if c.pathStyle {
+		p = path.Join("/", c.bucket, key)
+	} else {
+		u.Host = c.bucket + "." + u.Host
+	}
+	u.Path = p
+	u.RawPath = s3Escape(p, false)
+	return &u
+}
+
+// s3Escape URI encodes s, as Signature Version 4 requires: everything but the
+// unreserved characters, and, unless encodeSlash is set, '/'
+func s3Escape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case 'A' <= ch && ch <= 'Z', 'a' <= ch && ch <= 'z', '0' <= ch && ch <= '9',
+			ch == '-', ch == '.', ch == '_', ch == '~':
+			b.WriteByte(ch)
+		case ch == '/' && !encodeSlash:
+			b.WriteByte(ch)
+		default:
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
+
+// s3Query returns the canonical (sorted and encoded) query string of query
+func s3Query(query url.Values) string {
+	var keys []string
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			pairs = append(pairs, s3Escape(k, true)+"="+s3Escape(v, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// signV4 adds the Signature Version 4 Authorization header to req, signing
+// the host and all of req's headers.
+//
+// See https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html
+func signV4(req *http.Request, payloadHash string, accessKeyID string, secretAccessKey string, region string, t time.Time) {
+	amzDate := t.UTC().Format(s3DateFormat)
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		var trimmed []string
+		for _, v := range values {
+			trimmed = append(trimmed, strings.Join(strings.Fields(v), " "))
+		}
+		headers[strings.ToLower(name)] = strings.Join(trimmed, ",")
+	}
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := strings.Join([]string{date, region, s3Service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		s3Algorithm,
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, s3Service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, accessKeyID, scope, signedHeaders, signature))
+}
+
+// s3Error is the body of an S3 error response
+type s3Error struct {
+	Code    string
+	Message string
+}
+
+// do sends a signed request, and returns the response's body
+func (c *s3Client) do(method string, key string, query url.Values, header http.Header, body []byte) ([]byte, error) {
+	u := c.objectURL(key)
+	u.RawQuery = s3Query(query)
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if c.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.sessionToken)
+	}
+	signV4(req, sha256Hex(body), c.accessKeyID, c.secretAccessKey, c.region, time.Now())
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		var e s3Error
+		if xml.Unmarshal(data, &e) == nil && e.Code != "" {
+			return nil, fmt.Errorf("%s %s: %s: %s", method, u, e.Code, e.Message)
+		}
+		return nil, fmt.Errorf("%s %s: %s", method, u, resp.Status)
+	}
+	return data, nil
+}
+
+// listBucketResult is the body of a ListObjectsV2 response
+type listBucketResult struct {
+	IsTruncated           bool
+	NextContinuationToken string
+	Contents              []struct {
+		Key  string
+		ETag string
+	}
+}
+
+// list returns the ETags of the objects whose keys start with prefix
+func (c *s3Client) list(prefix string) (map[string]string, error) {
+	etags := make(map[string]string)
+	query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+	for {
+		data, err := c.do(http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result listBucketResult
+		err = xml.Unmarshal(data, &result)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range result.Contents {
+			etags[object.Key] = strings.Trim(object.ETag, `"`)
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return etags, nil
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+}
+
+// put uploads data to key
+func (c *s3Client) put(key string, data []byte, contentType string, cacheControl string) error {
+	sum := md5.Sum(data)
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Md5", base64.StdEncoding.EncodeToString(sum[:]))
+	if cacheControl != "" {
+		header.Set("Cache-Control", cacheControl)
+	}
+	_, err := c.do(http.MethodPut, key, nil, header, data)
+	return err
+}
+
+// publishFiles returns the files in dir to upload, relative to dir, with the
+// feeds last. Dot files (the cache, etc.) and skip are not included
+func publishFiles(dir string, skip string) (files []string) {
+	var feeds []string
+	err := filepath.Walk(dir, func(filename string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(fi.Name(), ".") && filename != dir {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !fi.Mode().IsRegular() || filepath.Clean(filename) == filepath.Clean(skip) {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, filename)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if isFeed(rel) {
+			feeds = append(feeds, rel)
+		} else {
+			files = append(files, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Cannot read %q: %s", dir, err)
+	}
+	return append(files, feeds...)
+}
+
+// enclosureFiles returns the files the enclosures in feedFile refer to that are
+// not in dir, relative to base_url: with tag_in_place, a track that is not
+// renamed stays where it is, in the current directory
+func enclosureFiles(feedFile string, dir string) (files []string) {
+	f, err := os.Open(feedFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Fatalf("Cannot open %q: %s", feedFile, err)
+		}
+		return nil
+	}
+	defer f.Close()
+	p, err := fpodcast.Decode(f)
+	if err != nil {
+		log.Fatalf("Cannot process %q: %s", feedFile, err)
+	}
+	for _, item := range p.Items {
+		if item.Enclosure == nil || !strings.HasPrefix(item.Enclosure.URL, defaults.BaseURL) {
+			continue
+		}
+		rel := strings.TrimPrefix(item.Enclosure.URL, defaults.BaseURL)
+		if rel == "" {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(rel))); err == nil {
+			continue
+		}
+		files = append(files, rel)
+	}
+	return files
+}
+
+// upload uploads filename to key, unless its MD5 matches etag, the key's
+// ETag, and returns true if it was uploaded
+func (c *s3Client) upload(filename string, key string, etag string, cacheControl string) (bool, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return false, err
+	}
+	sum := md5.Sum(data)
+	if etag == hex.EncodeToString(sum[:]) {
+		log.Debugf("Skipping %q: it is unchanged", filename)
+		return false, nil
+	}
+	if dryRun {
+		planUpload(filename, c.objectURL(key).String())
+		return true, nil
+	}
+	log.Infof("Uploading %q to %q", filename, c.objectURL(key))
+	return true, c.put(key, data, contentType(key), cacheControl)
+}
+
+// publish uploads the files in output_dir, and the enclosures that are not in
+// it, that have changed, for the .yaml file in args, and returns the exit code
+func publish(args []string) int {
+	flags := flag.NewFlagSet("publish", flag.ExitOnError)
+	flags.Parse(args)
+
+	yamlFile := defaultYAML
+	if flags.NArg() > 0 {
+		yamlFile = flags.Arg(0)
+	}
+	readYAML(yamlFile)
+
+	p := &defaults.Publish
+	c := newS3Client(p)
+	prefix := strings.Trim(p.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	log.Infof("Listing %q", c.objectURL(prefix))
+	etags, err := c.list(prefix)
+	if err != nil {
+		log.Fatalf("Cannot list %q: %s", c.objectURL(prefix), err)
+	}
+
+	// the enclosures outside output_dir go first, as the feeds refer to them
+	outside := enclosureFiles(defaults.OutputFile, defaults.OutputDir)
+	files := append(outside, publishFiles(defaults.OutputDir, guidFilename())...)
+	uploaded := 0
+	unchanged := 0
+	for i, rel := range files {
+		filename := filepath.Join(defaults.OutputDir, filepath.FromSlash(rel))
+		if i < len(outside) {
+			filename = filepath.FromSlash(rel)
+		}
+		key := prefix + rel
+		cacheControl := p.MediaCacheControl
+		if isFeed(rel) {
+			cacheControl = p.FeedCacheControl
+		}
+		ok, err := c.upload(filename, key, etags[key], cacheControl)
+		if err != nil {
+			log.Fatalf("Cannot upload %q: %s", filename, err)
+		}
+		if ok {
+			uploaded++
+		} else {
+			unchanged++
+		}
+	}
+	log.Infof("Uploaded %d files, %d were unchanged", uploaded, unchanged)
+	return 0
+}
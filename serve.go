@@ -0,0 +1,232 @@
+package main
+
+// feedster serve: preview the output directory over HTTP, before uploading it
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"flag"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	serveAddr     = ":8080"
+	watchInterval = time.Second
+)
+
+// rewriteExtensions are the files whose base_url is replaced with the server's URL
+var rewriteExtensions = map[string]bool{
+	".atom": true,
+	".html": true,
+	".json": true,
+	".xml":  true,
+}
+
+// server serves the output directory of yamlFile
+type server struct {
+	sync.RWMutex
+	yamlFile   string
+	baseURL    string
+	outputDir  string
+	outputFile string
+	// dirs are the directories watch scans for changes
+	dirs []string
+}
+
+// load reads yamlFile's settings, without building anything
+func (s *server) load() {
+	s.Lock()
+	defer s.Unlock()
+	readYAML(s.yamlFile)
+	s.update()
+}
+
+func (s *server) update() {
+	s.baseURL = defaults.BaseURL
+	s.outputDir = defaults.OutputDir
+	s.outputFile = defaults.OutputFile
+}
+
+// build runs feedster on yamlFile, in a child process, as a failed build
+// exits. If the build fails, the server keeps serving the previous output
+func (s *server) build() {
+	s.Lock()
+	defer s.Unlock()
+
+	executable, err := os.Executable()
+	if err != nil {
+		executable = os.Args[0]
+	}
+	cmd := exec.Command(executable, "-log", strconv.Itoa(int(log.GetLevel())), s.yamlFile)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	if err != nil {
+		log.Errorf("Cannot build %q (%s), serving the previous output", s.yamlFile, err)
+		return
+	}
+
+	readYAML(s.yamlFile)
+	s.update()
+	s.dirs = s.inputDirs()
+}
+
+// inputDirs returns the directories of yamlFile, the tracks file, and the
+// files the tracks reference: the media, images, chapters and transcripts
+func (s *server) inputDirs() (dirs []string) {
+	seen := make(map[string]bool)
+	add := func(filename string) {
+		// skip URLs, and chapters that are not files
+		if _, err := os.Stat(filename); filename == "" || err != nil {
+			return
+		}
+		dir := filepath.Dir(filename)
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+
+	add(s.yamlFile)
+	add(defaults.Image)
+	tracksFile := getTracksFilename(s.yamlFile)
+	add(tracksFile)
+	for _, track := range readTracks(tracksFile) {
+		add(track.Filename)
+		add(track.Image)
+		add(track.Chapters)
+		add(track.Transcript)
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// inputsSignature returns a hash of the names, sizes and modification times
+// of the files in dirs (but not their subdirectories, such as output_dir)
+func inputsSignature(dirs []string) string {
+	h := sha1.New()
+	for _, dir := range dirs {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			log.Warnf("Cannot read %q: %s", dir, err)
+			continue
+		}
+		for _, fi := range files {
+			if !fi.Mode().IsRegular() || strings.HasPrefix(fi.Name(), ".") {
+				continue
+			}
+			fmt.Fprintf(h, "%s,%d,%d\n", filepath.Join(dir, fi.Name()), fi.Size(), fi.ModTime().UnixNano())
+		}
+	}
+	return string(h.Sum(nil))
+}
+
+// watch rebuilds when the files in the input directories change
+func (s *server) watch() {
+	signature := inputsSignature(s.dirs)
+	for range time.Tick(watchInterval) {
+		if inputsSignature(s.dirs) == signature {
+			continue
+		}
+		log.Infof("Inputs have changed, rebuilding %q", s.yamlFile)
+		s.build()
+		// ignore the changes the build made itself (e.g. tag_in_place)
+		signature = inputsSignature(s.dirs)
+	}
+}
+
+// ServeHTTP serves the files in output_dir, with byte-range support, replacing
+// base_url with the server's URL in the feeds and pages
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.RLock()
+	defer s.RUnlock()
+
+	name := path.Clean("/" + r.URL.Path)
+	log.Debugf("%s %s %s", r.RemoteAddr, r.Method, name)
+	if name == "/" {
+		if _, err := os.Stat(s.outputDir + siteIndexName); err != nil {
+			http.Redirect(w, r, "/"+path.Base(s.outputFile), http.StatusFound)
+			return
+		}
+		// the site's index.html
+		name += siteIndexName
+	}
+	// don't serve .feedster-cache.json, etc.
+	if strings.HasPrefix(path.Base(name), ".") {
+		http.NotFound(w, r)
+		return
+	}
+
+	f, err := http.Dir(s.outputDir).Open(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType(name))
+	if !rewriteExtensions[strings.ToLower(path.Ext(name))] || s.baseURL == "" {
+		http.ServeContent(w, r, name, fi.ModTime(), f)
+		return
+	}
+
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	localURL := "http://" + r.Host + "/"
+	data = bytes.Replace(data, []byte(s.baseURL), []byte(localURL), -1)
+	if escaped := html.EscapeString(s.baseURL); escaped != s.baseURL {
+		data = bytes.Replace(data, []byte(escaped), []byte(html.EscapeString(localURL)), -1)
+	}
+	http.ServeContent(w, r, name, fi.ModTime(), bytes.NewReader(data))
+}
+
+// serve runs the preview server, for the .yaml file in args
+func serve(args []string) int {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := flags.String("addr", serveAddr, "address to listen on")
+	watch := flags.Bool("watch", false, "rebuild when the input files change")
+	flags.Parse(args)
+
+	s := &server{yamlFile: defaultYAML}
+	if flags.NArg() > 0 {
+		s.yamlFile = flags.Arg(0)
+	}
+
+	s.load()
+	// until a build succeeds, and reads the tracks file
+	s.dirs = []string{filepath.Dir(s.yamlFile)}
+	if *watch {
+		s.build()
+		go s.watch()
+	}
+
+	log.Infof("Serving %q on %s (feed: http://localhost%s/%s)", s.outputDir, *addr, *addr, path.Base(s.outputFile))
+	err := http.ListenAndServe(*addr, s)
+	if err != nil {
+		log.Errorf("Cannot serve %q: %s", s.outputDir, err)
+		return 1
+	}
+	return 0
+}
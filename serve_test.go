@@ -0,0 +1,63 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestServeHTTP(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"show.xml":             `<enclosure url="https://example.com/pod/one.mp3?a=1&amp;b=2"/>`,
+		"one.mp3":              "0123456789",
+		".feedster-cache.json": "{}",
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := &server{
+		baseURL:    "https://example.com/pod/",
+		outputDir:  dir + "/",
+		outputFile: "show.xml",
+	}
+
+	tests := []struct {
+		path, rangeHeader string
+		wantStatus        int
+		wantBody          string
+	}{
+		{"/show.xml", "", http.StatusOK, `<enclosure url="http://localhost:8080/one.mp3?a=1&amp;b=2"/>`},
+		// ranges of the rewritten feed
+		{"/show.xml", "bytes=0-13", http.StatusPartialContent, `<enclosure url`},
+		{"/show.xml", "bytes=16-37", http.StatusPartialContent, `http://localhost:8080/`},
+		{"/one.mp3", "", http.StatusOK, "0123456789"},
+		{"/one.mp3", "bytes=2-5", http.StatusPartialContent, "2345"},
+		{"/one.mp3", "bytes=-3", http.StatusPartialContent, "789"},
+		{"/one.mp3", "bytes=20-30", http.StatusRequestedRangeNotSatisfiable, ""},
+		{"/.feedster-cache.json", "", http.StatusNotFound, ""},
+		{"/../show.xml", "", http.StatusOK, `<enclosure url="http://localhost:8080/one.mp3?a=1&amp;b=2"/>`},
+		{"/missing.mp3", "", http.StatusNotFound, ""},
+		// no index.html: the feed
+		{"/", "", http.StatusFound, ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "http://localhost:8080"+tt.path, nil)
+		if tt.rangeHeader != "" {
+			r.Header.Set("Range", tt.rangeHeader)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		if w.Code != tt.wantStatus {
+			t.Errorf("GET %s (Range: %s): status %d, want %d", tt.path, tt.rangeHeader, w.Code, tt.wantStatus)
+			continue
+		}
+		if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+			t.Errorf("GET %s (Range: %s) = %q, want %q", tt.path, tt.rangeHeader, w.Body.String(), tt.wantBody)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+// site: generate a web site, with an index.html, and a page per episode, in output_dir
+
+import (
+	"embed"
+	"html"
+	"html/template"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	fpodcast "github.com/rasa/feedster/podcast"
+	log "github.com/sirupsen/logrus"
+)
+
+// siteTemplates are the built-in templates, which the files in site_templates
+// replace
+//
+//go:embed html/index.html html/episode.html
+var siteTemplates embed.FS
+
+const (
+	siteIndexName   = "index.html"
+	siteEpisodeName = "episode.html"
+	siteDateMask    = "January 2, 2006"
+)
+
+// SiteEpisode is an episode, as the templates see it
+type SiteEpisode struct {
+	Item      *fpodcast.Item
+	Track     *Track
+	Page      string
+	URL       string
+	Image     string
+	Duration  string
+	Published string
+	Video     bool
+	Newer     *SiteEpisode
+	Older     *SiteEpisode
+}
+
+// SitePage is the data the templates are executed with. Episode is only set
+// for the episode pages
+type SitePage struct {
+	Podcast  *fpodcast.Podcast
+	Image    string
+	FeedURL  string
+	AtomURL  string
+	JSONURL  string
+	Episodes []*SiteEpisode
+	Episode  *SiteEpisode
+}
+
+// siteNotes returns the show notes s as HTML: as-is, if they contain HTML
+// tags, or else escaped, with blank lines as paragraphs, and newlines as breaks
+func siteNotes(s string) template.HTML {
+	if fpodcast.IsHTML(s) {
+		return template.HTML(s)
+	}
+	var paragraphs []string
+	for _, p := range strings.Split(strings.Replace(s, "\r\n", "\n", -1), "\n\n") {
+		p = strings.TrimSpace(p)
+		if p != "" {
+			paragraphs = append(paragraphs, "<p>"+strings.Replace(html.EscapeString(p), "\n", "<br>\n", -1)+"</p>")
+		}
+	}
+	return template.HTML(strings.Join(paragraphs, "\n"))
+}
+
+// sitePageName returns the name of the track's page, which is the track's
+// name, with .html, unless the index, or an HTML transcript, has that name
+func sitePageName(track *Track) string {
+	name := basename(path.Base(track.OutputName))
+	page := name + ".html"
+	if page == siteIndexName {
+		return name + "-episode.html"
+	}
+	for _, f := range transcriptFiles(track) {
+		if f.Name == page {
+			return name + "-episode.html"
+		}
+	}
+	return page
+}
+
+// parseSiteTemplate returns the template named name, from site_templates, if
+// it is there, or else the built-in one
+func parseSiteTemplate(name string) *template.Template {
+	t := template.New(name).Funcs(template.FuncMap{"notes": siteNotes})
+	var err error
+	filename := ""
+	if defaults.SiteTemplates != "" {
+		filename = filepath.Join(defaults.SiteTemplates, name)
+		if _, err = os.Stat(filename); err != nil {
+			filename = ""
+		}
+	}
+	if filename != "" {
+		log.Debugf("Using %q", filename)
+		t, err = t.ParseFiles(filename)
+	} else {
+		filename = "html/" + name
+		t, err = t.ParseFS(siteTemplates, filename)
+	}
+	if err != nil {
+		log.Fatalf("Cannot parse %q: %s", filename, err)
+	}
+	return t
+}
+
+// podcastImage returns the URL of the podcast's image
+func podcastImage(p *fpodcast.Podcast) string {
+	if p.IImage != nil && p.IImage.HREF != "" {
+		return p.IImage.HREF
+	}
+	if p.Image != nil {
+		return p.Image.URL
+	}
+	return ""
+}
+
+// siteEpisodes returns the episodes of the tracks, newest first, and those
+// without a date last
+func siteEpisodes(p *fpodcast.Podcast, tracks []*Track, image string) (episodes []*SiteEpisode) {
+	items := make(map[string]*fpodcast.Item)
+	for _, item := range p.Items {
+		if item.Enclosure != nil {
+			items[item.Enclosure.URL] = item
+		}
+	}
+	for _, track := range tracks {
+		if !track.IsValid() || track.OutputName == "" {
+			continue
+		}
+		item := items[defaults.BaseURL+track.OutputName]
+		if item == nil {
+			continue
+		}
+		e := &SiteEpisode{
+			Item:  item,
+			Track: track,
+			Page:  sitePageName(track),
+			Image: image,
+			Video: strings.HasPrefix(item.Enclosure.Type.String(), "video/"),
+		}
+		e.URL = defaults.BaseURL + e.Page
+		if item.IImage != nil {
+			e.Image = item.IImage.HREF
+		}
+		if track.DurationMilliseconds > 0 {
+			e.Duration = track.Duration()
+		}
+		if item.PubDate != nil {
+			e.Published = item.PubDate.Format(siteDateMask)
+		}
+		episodes = append(episodes, e)
+	}
+	sort.SliceStable(episodes, func(i, j int) bool {
+		a, b := episodes[i].Item.PubDate, episodes[j].Item.PubDate
+		if a == nil || b == nil {
+			return a != nil
+		}
+		return a.After(*b)
+	})
+	for i, e := range episodes {
+		if i > 0 {
+			e.Newer = episodes[i-1]
+		}
+		if i < len(episodes)-1 {
+			e.Older = episodes[i+1]
+		}
+	}
+	return episodes
+}
+
+// writeSite saves the index.html, and a page for each episode, in outputDir
+func writeSite(p *fpodcast.Podcast, tracks []*Track, outputDir string) {
+	if !defaults.site {
+		return
+	}
+	index := parseSiteTemplate(siteIndexName)
+	episode := parseSiteTemplate(siteEpisodeName)
+
+	page := SitePage{
+		Podcast: p,
+		Image:   podcastImage(p),
+		FeedURL: defaults.BaseURL + path.Base(defaults.OutputFile),
+	}
+	if defaults.AtomFile != "" {
+		page.AtomURL = defaults.BaseURL + path.Base(defaults.AtomFile)
+	}
+	if defaults.JSONFile != "" {
+		page.JSONURL = defaults.BaseURL + path.Base(defaults.JSONFile)
+	}
+	page.Episodes = siteEpisodes(p, tracks, page.Image)
+
+	writeFeed(outputDir+siteIndexName, func(w io.Writer) error {
+		return index.Execute(w, page)
+	})
+	for _, e := range page.Episodes {
+		episodePage := page
+		episodePage.Episode = e
+		writeFeed(outputDir+e.Page, func(w io.Writer) error {
+			return episode.Execute(w, episodePage)
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	fpodcast "github.com/rasa/feedster/podcast"
+)
+
+func TestSiteNotes(t *testing.T) {
+	for notes, want := range map[string]string{
+		"<p>Already <b>HTML</b></p>": "<p>Already <b>HTML</b></p>",
+		"One\nline & two\n\nThree":   "<p>One<br>\nline &amp; two</p>\n<p>Three</p>",
+		"":                           "",
+	} {
+		if got := string(siteNotes(notes)); got != want {
+			t.Errorf("siteNotes(%q) = %q, want %q", notes, got, want)
+		}
+	}
+}
+
+func TestSitePageName(t *testing.T) {
+	for outputName, want := range map[string]string{
+		"01-intro.mp3": "01-intro.html",
+		"index.mp3":    "index-episode.html",
+	} {
+		if got := sitePageName(&Track{OutputName: outputName}); got != want {
+			t.Errorf("sitePageName(%q) = %q, want %q", outputName, got, want)
+		}
+	}
+}
+
+func TestSiteEpisodes(t *testing.T) {
+	defer func(d *Default) { defaults = d }(defaults)
+	defaults = &Default{BaseURL: "https://example.com/show/"}
+
+	p := &fpodcast.Podcast{}
+	var tracks []*Track
+	for _, ep := range []struct {
+		name string
+		day  int // 0: undated
+	}{{"undated1", 0}, {"ep1", 1}, {"ep3", 3}, {"undated2", 0}, {"ep2", 2}} {
+		item := &fpodcast.Item{Title: ep.name}
+		if ep.day > 0 {
+			pubDate := time.Date(2024, 1, ep.day, 0, 0, 0, 0, time.UTC)
+			item.PubDate = &pubDate
+		}
+		item.AddEnclosure(defaults.BaseURL+ep.name+".mp3", fpodcast.MP3, 1)
+		p.Items = append(p.Items, item)
+		tracks = append(tracks, &Track{Filename: ep.name + ".mp3", OutputName: ep.name + ".mp3"})
+	}
+
+	want := []string{"ep3", "ep2", "ep1", "undated1", "undated2"}
+	episodes := siteEpisodes(p, tracks, "")
+	if len(episodes) != len(want) {
+		t.Fatalf("siteEpisodes() returned %d episodes, want %d", len(episodes), len(want))
+	}
+	for i, e := range episodes {
+		if e.Item.Title != want[i] {
+			t.Errorf("siteEpisodes()[%d] = %q, want %q", i, e.Item.Title, want[i])
+		}
+	}
+	if episodes[0].Newer != nil || episodes[0].Older != episodes[1] || episodes[4].Newer != episodes[3] {
+		t.Error("siteEpisodes() did not link the episodes in order")
+	}
+}
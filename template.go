@@ -0,0 +1,227 @@
+package main
+
+// templates: text/template in the tracks file's cells, the *_template settings, and the -podcast.yaml file
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"text/template"
+	"time"
+
+	fpodcast "github.com/rasa/feedster/podcast"
+	log "github.com/sirupsen/logrus"
+)
+
+// earlyTemplateColumns are the tracks file columns that are used as the
+// tracks are preprocessed, in the order they are evaluated, so the others can
+// use the track number, etc. Their templates are evaluated before the files
+// are read, so they can only use the track's fields, and Podcast
+var earlyTemplateColumns = []string{
+	"filename",
+	"pubdate",
+	"year",
+	"track",
+	"disc_number",
+	"season",
+	"episode",
+	"episode_type",
+	"length",
+	"image",
+	"chapters",
+	"transcript",
+}
+
+// templateColumns returns the other tracks file columns, in the order they
+// are evaluated: the title first, so the others can use it
+func templateColumns() []string {
+	early := make(map[string]bool)
+	for _, column := range earlyTemplateColumns {
+		early[column] = true
+	}
+	columns := []string{"title"}
+	t := reflect.TypeOf(Track{})
+	for i := 0; i < t.NumField(); i++ {
+		column := strings.Split(t.Field(i).Tag.Get("csv"), ",")[0]
+		if column != "" && column != "title" && !early[column] {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
+
+// templateFuncs are the functions the templates can use, in addition to the
+// text/template built-ins
+var templateFuncs = template.FuncMap{
+	// {{.PubDate | date "Jan 2006"}}
+	"date": func(layout string, t time.Time) string {
+		return t.Format(layout)
+	},
+}
+
+// isTemplate returns true if s is a template
+func isTemplate(s string) bool {
+	return strings.Contains(s, "{{")
+}
+
+// templateData returns the values the track's templates see: the track's
+// fields, by name, with PubDate as a time, and the computed values: Duration
+// (hh:mm:ss), DurationSeconds, Number (of the track, in the feed), TotalDiscs,
+// TotalTracks (of the track's disc), TotalEpisodes, TotalDuration, and Podcast
+func templateData(fp *fpodcast.Podcast, track *Track, number int, tracks []*Track) map[string]interface{} {
+	data := fieldsData(track)
+
+	var total int64
+	for _, t := range tracks {
+		if t.IsValid() {
+			total += t.DurationMilliseconds
+		}
+	}
+	data["PubDate"] = time.Unix(0, track.ModTime).In(defaults.location)
+	data["Duration"] = track.Duration()
+	data["DurationSeconds"] = (track.DurationMilliseconds + 999) / 1000
+	data["Number"] = number
+	data["TotalDiscs"] = totalDiscs(tracks)
+	data["TotalTracks"] = totalTracks(tracks, track.DiscNumber)
+	data["TotalEpisodes"] = int(validTracks(tracks))
+	data["TotalDuration"] = (&Track{DurationMilliseconds: total}).Duration()
+	data["Podcast"] = fp
+	return data
+}
+
+// executeTemplate returns the result of the template text, for data
+func executeTemplate(name string, text string, data map[string]interface{}) (string, error) {
+	t, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	err = t.Execute(&buf, data)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// fieldsData returns the track's fields, by name
+func fieldsData(track *Track) map[string]interface{} {
+	data := make(map[string]interface{})
+	val := reflect.ValueOf(track).Elem()
+	for i := 0; i < val.NumField(); i++ {
+		data[val.Type().Field(i).Name] = val.Field(i).Interface()
+	}
+	return data
+}
+
+// applyColumnTemplates replaces the track's cells in columns that are
+// templates with their results, for data, which is updated as they are
+func applyColumnTemplates(track *Track, columns []string, data map[string]interface{}) {
+	for _, column := range columns {
+		value := track.Get(column)
+		if !isTemplate(value) {
+			continue
+		}
+		result, err := executeTemplate(column, value, data)
+		if err != nil {
+			log.Fatalf("Cannot process the %s template of %q: %s", column, track.Filename, err)
+		}
+		log.Debugf("%q: %s: %q", track.Filename, column, result)
+		track.Set(column, result)
+		data[templateField(column)] = track.Get(column)
+	}
+}
+
+// applyEarlyTemplates replaces the track's cells in earlyTemplateColumns that
+// are templates with their results. It runs before the track is preprocessed
+func applyEarlyTemplates(fp *fpodcast.Podcast, track *Track) {
+	data := fieldsData(track)
+	data["Podcast"] = fp
+	applyColumnTemplates(track, earlyTemplateColumns, data)
+}
+
+// applyTemplates replaces the other cells of the valid tracks that are
+// templates (including those the *_template settings, and copyright_mask,
+// filled in) with their results. It runs after the tracks are preprocessed,
+// so the durations, totals and seasons are known, and before they are tagged
+func applyTemplates(fp *fpodcast.Podcast, tracks []*Track) {
+	columns := templateColumns()
+	number := 0
+	for _, track := range tracks {
+		if !track.IsValid() {
+			continue
+		}
+		number++
+		applyColumnTemplates(track, columns, templateData(fp, track, number, tracks))
+	}
+}
+
+// applyPodcastTemplates replaces the values in the -podcast.yaml file that are
+// templates with their results. They can use TotalDiscs, TotalEpisodes,
+// TotalDuration, and Podcast. It runs after the tracks are preprocessed, and
+// before their templates are evaluated, so they can use the results
+func applyPodcastTemplates(fp *fpodcast.Podcast, tracks []*Track) {
+	var total int64
+	for _, t := range tracks {
+		if t.IsValid() {
+			total += t.DurationMilliseconds
+		}
+	}
+	data := map[string]interface{}{
+		"TotalDiscs":    totalDiscs(tracks),
+		"TotalEpisodes": int(validTracks(tracks)),
+		"TotalDuration": (&Track{DurationMilliseconds: total}).Duration(),
+		"Podcast":       fp,
+	}
+	setTemplates(reflect.ValueOf(fp).Elem(), "", data)
+}
+
+// setTemplates replaces the strings in v, and in its fields, pointers and
+// slices, that are templates, with their results, for data. name is v's key
+// in the -podcast.yaml file
+func setTemplates(v reflect.Value, name string, data map[string]interface{}) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			setTemplates(v.Elem(), name, data)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" {
+				// unexported
+				continue
+			}
+			key := strings.ToLower(field.Name)
+			if name != "" {
+				key = name + "." + key
+			}
+			setTemplates(v.Field(i), key, data)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			setTemplates(v.Index(i), name, data)
+		}
+	case reflect.String:
+		if !isTemplate(v.String()) || !v.CanSet() {
+			return
+		}
+		result, err := executeTemplate(name, v.String(), data)
+		if err != nil {
+			log.Fatalf("Cannot process the %s template in %q: %s", name, defaults.PodcastFile, err)
+		}
+		log.Debugf("%s: %q", name, result)
+		v.SetString(result)
+	}
+}
+
+// templateField returns the name of the Track field of the tracks file column
+func templateField(column string) string {
+	t := reflect.TypeOf(Track{})
+	for i := 0; i < t.NumField(); i++ {
+		if strings.Split(t.Field(i).Tag.Get("csv"), ",")[0] == column {
+			return t.Field(i).Name
+		}
+	}
+	return ""
+}
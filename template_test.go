@@ -0,0 +1,129 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	fpodcast "github.com/rasa/feedster/podcast"
+)
+
+func TestExecuteTemplate(t *testing.T) {
+	data := map[string]interface{}{
+		"Title":       "Intro",
+		"Track":       "3",
+		"TotalTracks": 10,
+		"PubDate":     time.Date(2021, 5, 4, 0, 0, 0, 0, time.UTC),
+	}
+	got, err := executeTemplate("description", `{{.Title}}: Part {{.Track}} of {{.TotalTracks}}. Recorded {{.PubDate | date "Jan 2006"}}`, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Intro: Part 3 of 10. Recorded May 2021"
+	if got != want {
+		t.Errorf("executeTemplate() = %q, want %q", got, want)
+	}
+	if _, err := executeTemplate("title", "{{.Missing}}", data); err == nil {
+		t.Errorf("executeTemplate() with a missing key: want an error")
+	}
+}
+
+func TestTemplateField(t *testing.T) {
+	for column, want := range map[string]string{
+		"title":        "Title",
+		"album_artist": "AlbumArtist",
+		"track":        "Track",
+		"missing":      "",
+	} {
+		if got := templateField(column); got != want {
+			t.Errorf("templateField(%q) = %q, want %q", column, got, want)
+		}
+	}
+}
+
+func TestApplyTemplates(t *testing.T) {
+	defer func(d *Default) { defaults = d }(defaults)
+	defaults = &Default{location: time.UTC}
+
+	track := &Track{
+		Filename:    "intro.mp3",
+		Title:       "{{.Podcast.Title}} {{.Number}}",
+		Track:       "1",
+		Description: `{{.Title}}: {{"{{"}}braces{{"}}"}}`,
+		Genre:       "{{.Podcast.Title}}",
+		GUID:        "urn:{{.Number}}",
+		Person:      "{{.Artist}} (host)",
+		Artist:      "Ann",
+	}
+	fp := fpodcast.Podcast{Title: "Show"}
+	applyTemplates(&fp, []*Track{track})
+
+	for _, tt := range []struct {
+		column, got, want string
+	}{
+		{"title", track.Title, "Show 1"},
+		{"description", track.Description, "Show 1: {{braces}}"},
+		{"genre", track.Genre, "Show"},
+		{"guid", track.GUID, "urn:1"},
+		{"person", track.Person, "Ann (host)"},
+	} {
+		if tt.got != tt.want {
+			t.Errorf("applyTemplates(): %s = %q, want %q", tt.column, tt.got, tt.want)
+		}
+	}
+}
+
+func TestApplyEarlyTemplates(t *testing.T) {
+	track := &Track{
+		Filename:   "lesson{{.Track}}.mp3",
+		Track:      "3",
+		Season:     "{{.Podcast.Title | len}}",
+		Episode:    "{{.Track}}",
+		Chapters:   "00:00 {{.Title}}",
+		Transcript: "lesson{{.Track}}.srt",
+		Title:      "Lesson {{.Track}}",
+	}
+	fp := fpodcast.Podcast{Title: "Show"}
+	applyEarlyTemplates(&fp, track)
+
+	for _, tt := range []struct {
+		column, got, want string
+	}{
+		{"filename", track.Filename, "lesson3.mp3"},
+		{"season", track.Season, "4"},
+		{"episode", track.Episode, "3"},
+		// the title is evaluated later, so it is seen as is
+		{"chapters", track.Chapters, "00:00 Lesson {{.Track}}"},
+		{"transcript", track.Transcript, "lesson3.srt"},
+		{"title", track.Title, "Lesson {{.Track}}"},
+	} {
+		if tt.got != tt.want {
+			t.Errorf("applyEarlyTemplates(): %s = %q, want %q", tt.column, tt.got, tt.want)
+		}
+	}
+}
+
+func TestApplyPodcastTemplates(t *testing.T) {
+	tracks := []*Track{
+		{Filename: "a.mp3", DurationMilliseconds: 60000},
+		{Filename: "b.mp3", DurationMilliseconds: 30000},
+	}
+	fp := fpodcast.Podcast{
+		Title:       "Show",
+		Description: "{{.Podcast.Title}}: {{.TotalEpisodes}} episodes, {{.TotalDuration}}",
+		ISummary:    &fpodcast.ISummary{Text: "{{.TotalEpisodes}} episodes"},
+		ICategories: []*fpodcast.ICategory{{Text: "{{.Podcast.Title}}"}},
+	}
+	applyPodcastTemplates(&fp, tracks)
+
+	for _, tt := range []struct {
+		key, got, want string
+	}{
+		{"description", fp.Description, "Show: 2 episodes, 00:01:30"},
+		{"isummary.text", fp.ISummary.Text, "2 episodes"},
+		{"icategories.text", fp.ICategories[0].Text, "Show"},
+	} {
+		if tt.got != tt.want {
+			t.Errorf("applyPodcastTemplates(): %s = %q, want %q", tt.key, tt.got, tt.want)
+		}
+	}
+}
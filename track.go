@@ -2,11 +2,13 @@ package main
 
 import (
 	"fmt"
+	"path/filepath"
 	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
 
+	fpodcast "github.com/rasa/feedster/podcast"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -24,25 +26,47 @@ type Track struct { // Our example struct, you can use "-" to ignore a field
 	AlbumArtist      string `csv:"album_artist,omitempty"`
 	AlbumTitle       string `csv:"album_title,omitempty"`
 	Artist           string `csv:"artist,omitempty"`
+	Chapters         string `csv:"chapters,omitempty"` // Item.PChapters: a URL, a .txt file, or "hh:mm:ss Title; ..."
 	Composer         string `csv:"composer,omitempty"`
 	Copyright        string `csv:"copyright,omitempty"`
 	Description      string `csv:"description,omitempty"` // Item.Description
 	DiscNumber       string `csv:"disc_number,omitempty"`
+	Episode          string `csv:"episode,omitempty"`      // Item.IEpisode, Item.PEpisode
+	EpisodeType      string `csv:"episode_type,omitempty"` // Item.IEpisodeType: full, trailer or bonus
 	Genre            string `csv:"genre,omitempty"`
+	GUID             string `csv:"guid,omitempty"`    // Item.GUID
+	Image            string `csv:"image,omitempty"`   // Item.IImage, and the front cover
+	Length           string `csv:"length,omitempty"`  // hh:mm:ss, used if the file's duration cannot be determined
+	Person           string `csv:"person,omitempty"`  // Item.PPersons: "Name (role); Name (role)"
+	PubDate          string `csv:"pubdate,omitempty"` // Item.PubDate: RFC1123, ISO-8601, yyyy-mm-dd, m/d/yyyy, or an Excel serial date
+	Season           string `csv:"season,omitempty"`  // Item.PSeason
 	Track            string `csv:"track,omitempty"`
-	Subtitle         string `csv:"subtitle,omitempty"` // Item.ISubtitle
-	Summary          string `csv:"summary,omitempty"`  // Item.ISummary
-	Title            string `csv:"title,omitempty"`    // Item.Title
+	Subtitle         string `csv:"subtitle,omitempty"`   // Item.ISubtitle
+	Summary          string `csv:"summary,omitempty"`    // Item.ISummary
+	Title            string `csv:"title,omitempty"`      // Item.Title
+	Transcript       string `csv:"transcript,omitempty"` // Item.PTranscripts: a URL, or an .srt, .vtt or .txt file
 	Year             string `csv:"year,omitempty"`
 	OriginalFilename string
-	// DurationMilliseconds is determined by running exiftool or ffprobe on filename
+	// Source is the master the track was encoded from, per the transcode section
+	Source string
+	// OutputName is the track's filename in the output directory, after renaming via rename_mask
+	OutputName string
+	// ChapterList is read from the chapters column, or <filename>.chapters.txt
+	ChapterList []Chapter
+	// Transcripts are read from the transcript column, or <name>.vtt, .srt and .txt
+	Transcripts []*Transcript
+	// DurationMilliseconds is determined by reading the MPEG audio frames in filename,
+	// or by running exiftool, ffprobe or ffmpeg on it, if duration_tools is true
 	DurationMilliseconds int64
-	// FileSize is the file's size via os.Stat()
+	// EnclosureType is determined by the file's container (MP3, M4A, etc.)
+	EnclosureType fpodcast.EnclosureType
+	// FileSize is the tagged file's size via os.Stat()
 	FileSize         int64
 	OriginalFileSize int64
 	// OriginalModTime is the nanoseconds of the last mod time via os.Stat()
 	OriginalModTime int64
-	// ModTime is the nanoseconds of the last mod time (less duration) via os.Stat()
+	// ModTime is the nanoseconds of the publication date: pubdate, if set,
+	// otherwise the last mod time via os.Stat()
 	ModTime   int64
 	Processed bool
 }
@@ -173,20 +197,62 @@ func (f *Track) NormalizeFilename() {
 		return
 	}
 	f.OriginalFilename = f.Filename
-	f.Filename = normalizeFilename(f.Filename)
+	// the directory, if any, is kept: the tracks may be in another directory
+	dir, file := filepath.Split(f.Filename)
+	f.Filename = dir + normalizeFilename(file)
 }
 
-// SetCopyright sets the copyright string
+// SetCopyright sets the copyright string: copyright, if set, or else
+// copyrightMask, a printf format of the year and artist, or a template
 func (f *Track) SetCopyright(copyright string, copyrightMask string, year int) {
 	if copyright != "" {
 		// f.Copyright := html.EscapeString(copyright)
 		f.Copyright = copyright
+	} else if isTemplate(copyrightMask) {
+		// evaluated by applyTemplates
+		f.Copyright = copyrightMask
 	} else {
 		// f.Copyright = fmt.Sprintf(html.EscapeString(copyrightMask), year, f.Artist)
 		f.Copyright = fmt.Sprintf(copyrightMask, year, f.Artist)
 	}
 }
 
+// SetSeasonEpisode sets the season and episode to the disc and track numbers,
+// if they are empty and auto is true, and clears them if they are invalid
+func (f *Track) SetSeasonEpisode(auto bool) {
+	if auto {
+		if f.Season == "" {
+			f.Season = f.DiscNumber
+		}
+		if f.Episode == "" {
+			f.Episode = f.Track
+		}
+	}
+	if f.Season != "" {
+		season, err := strconv.Atoi(f.Season)
+		if err != nil || season <= 0 {
+			log.Warnf("%q: invalid season: %q", f.Filename, f.Season)
+			f.Season = ""
+		}
+	}
+	if f.Episode != "" {
+		_, err := strconv.ParseFloat(f.Episode, 64)
+		if err != nil {
+			log.Warnf("%q: invalid episode: %q", f.Filename, f.Episode)
+			f.Episode = ""
+		}
+	}
+	if f.EpisodeType != "" {
+		f.EpisodeType = strings.ToLower(f.EpisodeType)
+		switch f.EpisodeType {
+		case "full", "trailer", "bonus":
+		default:
+			log.Warnf("%q: invalid episode_type: %q (must be full, trailer or bonus)", f.Filename, f.EpisodeType)
+			f.EpisodeType = ""
+		}
+	}
+}
+
 // NewName provides a new filename for the track based on the renameMask
 func (f *Track) NewName(renameMask string) (newTrackName string, err error) {
 	if renameMask == "" {
@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestSetSeasonEpisode(t *testing.T) {
+	tests := []struct {
+		auto                                     bool
+		track                                    Track
+		wantSeason, wantEpisode, wantEpisodeType string
+	}{
+		{false, Track{Season: "2", Episode: "3"}, "2", "3", ""},
+		{false, Track{Episode: "3.5"}, "", "3.5", ""},
+		{false, Track{DiscNumber: "2", Track: "3"}, "", "", ""},
+		{true, Track{DiscNumber: "2", Track: "3"}, "2", "3", ""},
+		{true, Track{DiscNumber: "2", Track: "3", Season: "4", Episode: "5"}, "4", "5", ""},
+		{false, Track{Season: "0"}, "", "", ""},
+		{false, Track{Season: "-1"}, "", "", ""},
+		{false, Track{Season: "one", Episode: "two"}, "", "", ""},
+		{true, Track{DiscNumber: "x", Track: "y"}, "", "", ""},
+		{false, Track{EpisodeType: "Trailer"}, "", "", "trailer"},
+		{false, Track{EpisodeType: "BONUS"}, "", "", "bonus"},
+		{false, Track{EpisodeType: "full"}, "", "", "full"},
+		{false, Track{EpisodeType: "teaser"}, "", "", ""},
+	}
+	for _, tt := range tests {
+		track := tt.track
+		track.SetSeasonEpisode(tt.auto)
+		if track.Season != tt.wantSeason || track.Episode != tt.wantEpisode || track.EpisodeType != tt.wantEpisodeType {
+			t.Errorf("SetSeasonEpisode(%v) of %+v: season %q, episode %q, episode_type %q, want %q, %q, %q",
+				tt.auto, tt.track, track.Season, track.Episode, track.EpisodeType, tt.wantSeason, tt.wantEpisode, tt.wantEpisodeType)
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package main
+
+// transcode: encode and loudness-normalize WAV, FLAC, etc. masters via ffmpeg
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	transcodeDirName  = ".feedster-encoded/"
+	transcodeFileName = ".feedster-transcode.json"
+	transcodeVersion  = 1
+)
+
+// Transcode is the transcode section of the .yaml files
+type Transcode struct {
+	Bitrate       string `yaml:"bitrate,omitempty"`
+	Channels      string `yaml:"channels,omitempty"`
+	Codec         string `yaml:"codec,omitempty"`
+	Loudness      string `yaml:"loudness,omitempty"`
+	LoudnessRange string `yaml:"loudness_range,omitempty"`
+	SampleRate    string `yaml:"sample_rate,omitempty"`
+	Sources       string `yaml:"sources,omitempty"`
+	TruePeak      string `yaml:"true_peak,omitempty"`
+	channels      string
+	sources       map[string]bool
+}
+
+// transcodeCodecs are the codecs' ffmpeg encoders, formats and extensions
+var transcodeCodecs = map[string]struct {
+	encoder string
+	format  string
+	ext     string
+}{
+	"aac": {"aac", "ipod", ".m4a"},
+	"mp3": {"libmp3lame", "mp3", ".mp3"},
+}
+
+// parse checks the transcode section's fields
+func (t *Transcode) parse() error {
+	t.sources = make(map[string]bool)
+	for _, ext := range strings.Split(t.Sources, ",") {
+		ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), "."))
+		if ext != "" {
+			t.sources["."+ext] = true
+		}
+	}
+	if t.Codec == "" {
+		return nil
+	}
+	if _, ok := transcodeCodecs[t.Codec]; !ok {
+		return fmt.Errorf("codec: %q is not mp3 or aac", t.Codec)
+	}
+	switch t.Channels {
+	case "":
+		t.channels = ""
+	case "mono":
+		t.channels = "1"
+	case "stereo":
+		t.channels = "2"
+	default:
+		return fmt.Errorf("channels: %q is not mono or stereo", t.Channels)
+	}
+	if _, err := strconv.Atoi(t.SampleRate); err != nil {
+		return fmt.Errorf("sample_rate: %s", err)
+	}
+	if t.Loudness != "" {
+		for field, value := range map[string]string{"loudness": t.Loudness, "loudness_range": t.LoudnessRange, "true_peak": t.TruePeak} {
+			if _, err := strconv.ParseFloat(value, 64); err != nil {
+				return fmt.Errorf("%s: %s", field, err)
+			}
+		}
+	}
+	return nil
+}
+
+// TranscodeEntry records what an encoded file was encoded from
+type TranscodeEntry struct {
+	Source string `json:"source"`
+	// Key is a hash of the source file, and the transcode settings
+	Key string `json:"key"`
+}
+
+// TranscodeCache holds the encoded files, keyed by filename, so they are only
+// encoded again if their source, or the transcode settings, change
+type TranscodeCache struct {
+	Version int                        `json:"version"`
+	Files   map[string]*TranscodeEntry `json:"files"`
+
+	filename string
+	used     map[string]bool
+}
+
+var transcodes *TranscodeCache
+
+func loadTranscodeCache(filename string) (c *TranscodeCache) {
+	c = &TranscodeCache{
+		Version:  transcodeVersion,
+		Files:    make(map[string]*TranscodeEntry),
+		filename: filename,
+		used:     make(map[string]bool),
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("Cannot read %q: %s", filename, err)
+		}
+		return c
+	}
+
+	var old TranscodeCache
+	err = json.Unmarshal(data, &old)
+	if err != nil {
+		log.Warnf("Cannot process %q: %s", filename, err)
+		return c
+	}
+	if old.Version != transcodeVersion {
+		log.Infof("Ignoring %q: version %d != %d", filename, old.Version, transcodeVersion)
+		return c
+	}
+	if old.Files != nil {
+		c.Files = old.Files
+	}
+	log.Debugf("Read %d transcode entries from %q", len(c.Files), filename)
+	return c
+}
+
+// Save writes the entries for the files encoded, or reused, in this run, to
+// the transcode cache file. The entries of the files that are no longer used
+// are kept, so they are not encoded again, if they are used again
+func (c *TranscodeCache) Save() {
+	if c == nil || len(c.used) == 0 {
+		return
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		log.Fatalf("Cannot process %q: %s", c.filename, err)
+	}
+	log.Debugf("Saving %d transcode entries to %q", len(c.Files), c.filename)
+	err = ioutil.WriteFile(c.filename, data, 0644)
+	if err != nil {
+		log.Warnf("Cannot write %q: %s", c.filename, err)
+	}
+}
+
+// transcodeKey returns a hash of filename's contents, and the transcode settings
+func transcodeKey(filename string, t *Transcode) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha1.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(h, "codec=%s\nbitrate=%s\nchannels=%s\nsample_rate=%s\n", t.Codec, t.Bitrate, t.Channels, t.SampleRate)
+	fmt.Fprintf(h, "loudness=%s\nloudness_range=%s\ntrue_peak=%s\n", t.Loudness, t.LoudnessRange, t.TruePeak)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// transcodedName returns the name of filename's encoded file, in output_dir's
+// encoded directory: its name, with the codec's extension, and, if another
+// master in this run has that name, a hash of its path
+func transcodedName(filename string, ext string) string {
+	name := basename(path.Base(filepath.ToSlash(filename)))
+	encoded := defaults.OutputDir + transcodeDirName + name + ext
+	if entry := transcodes.Files[encoded]; entry != nil && entry.Source != filename && transcodes.used[encoded] {
+		// "lesson01.mp3" -> "lesson01-1a2b3c4d.mp3"
+		sum := sha1.Sum([]byte(filename))
+		encoded = fmt.Sprintf("%s%s%s-%x%s", defaults.OutputDir, transcodeDirName, name, sum[:4], ext)
+	}
+	return encoded
+}
+
+// transcodeTrack encodes the track, if its extension is in the transcode
+// section's sources, to a file with the same name, and the codec's extension,
+// in output_dir, so the masters' directories are never written to, unless it
+// was already encoded, with the same settings, and uses that file
+func transcodeTrack(track *Track) {
+	t := &defaults.Transcode
+	if t.Codec == "" || !t.sources[strings.ToLower(path.Ext(track.Filename))] {
+		return
+	}
+
+	key, err := transcodeKey(track.Filename, t)
+	if err != nil {
+		log.Fatalf("Cannot open %q: %s", track.Filename, err)
+	}
+	encoded := transcodedName(track.Filename, transcodeCodecs[t.Codec].ext)
+	entry := transcodes.Files[encoded]
+	_, err = os.Stat(encoded)
+	switch {
+	case err == nil && entry != nil && entry.Source == track.Filename && entry.Key == key:
+		log.Debugf("%q is up to date", encoded)
+	case dryRun:
+		planEncode(track.Filename, encoded)
+		if err != nil {
+			// not encoded yet, so the rest of the plan uses the master
+			return
+		}
+	default:
+		log.Infof("Encoding %q to %q", track.Filename, encoded)
+		err = os.MkdirAll(path.Dir(encoded), os.ModePerm)
+		if err != nil {
+			log.Fatalf("Cannot create directory %q: %s", path.Dir(encoded), err)
+		}
+		err = encode(defaults.Ffmpeg, track.Filename, encoded, t)
+		if err != nil {
+			log.Fatalf("Cannot encode %q: %s", track.Filename, err)
+		}
+		transcodes.Files[encoded] = &TranscodeEntry{Source: track.Filename, Key: key}
+	}
+	transcodes.used[encoded] = true
+	track.Source = track.Filename
+	track.Filename = encoded
+}
+
+// loudnormStats are the measurements of ffmpeg's loudnorm filter's first pass
+type loudnormStats struct {
+	InputI       string `json:"input_i"`
+	InputTP      string `json:"input_tp"`
+	InputLRA     string `json:"input_lra"`
+	InputThresh  string `json:"input_thresh"`
+	TargetOffset string `json:"target_offset"`
+}
+
+// parseLoudnorm returns the stats loudnorm prints, as JSON, at the end of
+// ffmpeg's output
+func parseLoudnorm(output string) (stats loudnormStats, err error) {
+	i := strings.LastIndex(output, "{")
+	j := strings.LastIndex(output, "}")
+	if i < 0 || j < i {
+		return stats, fmt.Errorf("loudnorm stats not found")
+	}
+	err = json.Unmarshal([]byte(output[i:j+1]), &stats)
+	return stats, err
+}
+
+// runFfmpeg runs ffmpeg with args, and returns its output (on stderr)
+func runFfmpeg(ffmpeg string, args []string) (string, error) {
+	if ffmpeg == "" {
+		return "", fmt.Errorf("ffmpeg is not set")
+	}
+	args = append([]string{"-hide_banner", "-nostdin", "-y"}, args...)
+	cmd := exec.Command(ffmpeg, args...)
+	cmdline := fmt.Sprintf("%q %s", ffmpeg, args)
+	log.Debugf("Executing: %s", cmdline)
+	var berr bytes.Buffer
+	cmd.Stderr = &berr
+	err := cmd.Run()
+	serr := strings.TrimSpace(berr.String())
+	if serr != "" {
+		log.Debugf("stderr=%v", serr)
+	}
+	if err != nil {
+		return serr, fmt.Errorf("Command failed: %s: %s: %s", cmdline, err, serr)
+	}
+	return serr, nil
+}
+
+// loudnormTarget returns the loudnorm filter, with the transcode settings' targets
+func loudnormTarget(t *Transcode) string {
+	return fmt.Sprintf("loudnorm=I=%s:TP=%s:LRA=%s", t.Loudness, t.TruePeak, t.LoudnessRange)
+}
+
+// encodeArgs returns ffmpeg's arguments to encode src, per the transcode
+// settings, normalizing its loudness per stats, the first pass's
+// measurements, unless they are nil
+func encodeArgs(src string, t *Transcode, stats *loudnormStats) []string {
+	codec := transcodeCodecs[t.Codec]
+	args := []string{"-i", src, "-vn", "-map_metadata", "-1"}
+	if stats != nil {
+		args = append(args, "-af", fmt.Sprintf("%s:measured_I=%s:measured_TP=%s:measured_LRA=%s:measured_thresh=%s:offset=%s:linear=true",
+			loudnormTarget(t), stats.InputI, stats.InputTP, stats.InputLRA, stats.InputThresh, stats.TargetOffset))
+	}
+	// loudnorm resamples to 192kHz, so the sample rate is always set
+	args = append(args, "-ar", t.SampleRate)
+	if t.channels != "" {
+		args = append(args, "-ac", t.channels)
+	}
+	return append(args, "-c:a", codec.encoder, "-b:a", t.Bitrate, "-f", codec.format)
+}
+
+// encode encodes src to dst, per the transcode settings, normalizing its
+// loudness in two passes, if loudness is set: the first measures it, and the
+// second normalizes it, linearly, if possible
+//
+// See http://k.ylo.ph/2016/04/04/loudnorm.html
+func encode(ffmpeg string, src string, dst string, t *Transcode) error {
+	var measured *loudnormStats
+	if t.Loudness != "" {
+		output, err := runFfmpeg(ffmpeg, []string{"-i", src, "-vn", "-af", loudnormTarget(t) + ":print_format=json", "-f", "null", "-"})
+		if err != nil {
+			return err
+		}
+		stats, err := parseLoudnorm(output)
+		if err != nil {
+			return err
+		}
+		log.Debugf("Measured %q: %+v", src, stats)
+		if strings.Contains(stats.InputI, "inf") {
+			log.Warnf("%q is silent, not normalizing its loudness", src)
+		} else {
+			measured = &stats
+		}
+	}
+
+	tmp := dst + ".tmp"
+	_, err := runFfmpeg(ffmpeg, append(encodeArgs(src, t, measured), tmp))
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseLoudnorm(t *testing.T) {
+	output := `Input #0, wav, from 'lesson01.wav':
+  Duration: 00:00:52.12, bitrate: 1411 kb/s
+[Parsed_loudnorm_0 @ 0x55d0c8a0] 
+{
+	"input_i" : "-23.45",
+	"input_tp" : "-4.10",
+	"input_lra" : "6.70",
+	"input_thresh" : "-33.80",
+	"output_i" : "-16.02",
+	"output_tp" : "-1.00",
+	"output_lra" : "5.90",
+	"output_thresh" : "-26.30",
+	"normalization_type" : "dynamic",
+	"target_offset" : "0.02"
+}`
+	got, err := parseLoudnorm(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := loudnormStats{InputI: "-23.45", InputTP: "-4.10", InputLRA: "6.70", InputThresh: "-33.80", TargetOffset: "0.02"}
+	if got != want {
+		t.Errorf("parseLoudnorm() = %+v, want %+v", got, want)
+	}
+
+	_, err = parseLoudnorm("Conversion failed!")
+	if err == nil {
+		t.Error("parseLoudnorm(\"Conversion failed!\") succeeded, want an error")
+	}
+}
+
+func TestTranscodeKey(t *testing.T) {
+	dir := t.TempDir()
+	master := filepath.Join(dir, "lesson01.wav")
+	write := func(data string) {
+		if err := ioutil.WriteFile(master, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	settings := Transcode{Codec: "mp3", Bitrate: "96k", Channels: "mono", SampleRate: "44100", Loudness: "-16", LoudnessRange: "11", TruePeak: "-1"}
+
+	write("RIFF")
+	want, err := transcodeKey(master, &settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := transcodeKey(master, &settings); got != want {
+		t.Errorf("transcodeKey() = %q, then %q, want the same key", want, got)
+	}
+
+	changes := []struct {
+		name   string
+		change func(t *Transcode)
+	}{
+		{"codec", func(t *Transcode) { t.Codec = "aac" }},
+		{"bitrate", func(t *Transcode) { t.Bitrate = "128k" }},
+		{"channels", func(t *Transcode) { t.Channels = "stereo" }},
+		{"sample_rate", func(t *Transcode) { t.SampleRate = "48000" }},
+		{"loudness", func(t *Transcode) { t.Loudness = "-19" }},
+		{"loudness_range", func(t *Transcode) { t.LoudnessRange = "7" }},
+		{"true_peak", func(t *Transcode) { t.TruePeak = "-2" }},
+	}
+	for _, c := range changes {
+		changed := settings
+		c.change(&changed)
+		if got, _ := transcodeKey(master, &changed); got == want {
+			t.Errorf("transcodeKey() with a new %s = %q, want a different key", c.name, got)
+		}
+	}
+
+	write("RIFX")
+	if got, _ := transcodeKey(master, &settings); got == want {
+		t.Errorf("transcodeKey() of a new master = %q, want a different key", got)
+	}
+
+	if _, err := transcodeKey(filepath.Join(dir, "missing.wav"), &settings); err == nil {
+		t.Error("transcodeKey() of a missing file succeeded, want an error")
+	}
+}
+
+func TestEncodeArgs(t *testing.T) {
+	stats := &loudnormStats{InputI: "-23.45", InputTP: "-4.10", InputLRA: "6.70", InputThresh: "-33.80", TargetOffset: "0.02"}
+	tests := []struct {
+		settings Transcode
+		stats    *loudnormStats
+		want     string
+	}{
+		{
+			Transcode{Codec: "mp3", Bitrate: "96k", Channels: "mono", SampleRate: "44100", Loudness: "-16", LoudnessRange: "11", TruePeak: "-1"},
+			stats,
+			"-i a.wav -vn -map_metadata -1 " +
+				"-af loudnorm=I=-16:TP=-1:LRA=11:measured_I=-23.45:measured_TP=-4.10:measured_LRA=6.70:measured_thresh=-33.80:offset=0.02:linear=true " +
+				"-ar 44100 -ac 1 -c:a libmp3lame -b:a 96k -f mp3",
+		},
+		{
+			// silent, or loudness is blank
+			Transcode{Codec: "aac", Bitrate: "128k", SampleRate: "48000", Loudness: "-16", LoudnessRange: "11", TruePeak: "-1"},
+			nil,
+			"-i a.wav -vn -map_metadata -1 -ar 48000 -c:a aac -b:a 128k -f ipod",
+		},
+		{
+			Transcode{Codec: "aac", Bitrate: "64k", Channels: "stereo", SampleRate: "22050"},
+			nil,
+			"-i a.wav -vn -map_metadata -1 -ar 22050 -ac 2 -c:a aac -b:a 64k -f ipod",
+		},
+	}
+	for _, tt := range tests {
+		if err := tt.settings.parse(); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(encodeArgs("a.wav", &tt.settings, tt.stats), " "); got != tt.want {
+			t.Errorf("encodeArgs(%+v) =\n%s\nwant\n%s", tt.settings, got, tt.want)
+		}
+	}
+}
+
+func TestTranscodeTrack(t *testing.T) {
+	defer func(d *Default, c *TranscodeCache, n bool, w io.Writer) {
+		defaults, transcodes, dryRun, planOutput = d, c, n, w
+	}(defaults, transcodes, dryRun, planOutput)
+	dir := t.TempDir()
+	defaults = &Default{OutputDir: filepath.ToSlash(dir) + "/show/"}
+	defaults.Transcode = Transcode{Codec: "mp3", Bitrate: "96k", SampleRate: "44100", Sources: "wav"}
+	if err := defaults.Transcode.parse(); err != nil {
+		t.Fatal(err)
+	}
+	transcodes = loadTranscodeCache(defaults.OutputDir + transcodeFileName)
+	dryRun = true
+	var buf bytes.Buffer
+	planOutput = &buf
+
+	masters := filepath.Join(dir, "masters")
+	for _, name := range []string{"a/lesson01.wav", "b/lesson01.wav", "lesson01.mp3"} {
+		filename := filepath.Join(masters, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	encodedDir := defaults.OutputDir + transcodeDirName
+	if err := os.MkdirAll(encodedDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// a/lesson01.wav was encoded, with these settings
+	a := filepath.Join(masters, "a", "lesson01.wav")
+	key, err := transcodeKey(a, &defaults.Transcode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transcodes.Files[encodedDir+"lesson01.mp3"] = &TranscodeEntry{Source: a, Key: key}
+	if err := ioutil.WriteFile(encodedDir+"lesson01.mp3", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		filename string
+		want     string
+		plan     bool
+	}{
+		// up to date
+		{a, encodedDir + "lesson01.mp3", false},
+		// another master with the same name: not encoded yet
+		{filepath.Join(masters, "b", "lesson01.wav"), filepath.Join(masters, "b", "lesson01.wav"), true},
+		// not a master
+		{filepath.Join(masters, "lesson01.mp3"), filepath.Join(masters, "lesson01.mp3"), false},
+	}
+	for _, tt := range tests {
+		buf.Reset()
+		track := &Track{Filename: tt.filename}
+		transcodeTrack(track)
+		if track.Filename != tt.want {
+			t.Errorf("transcodeTrack(%q) uses %q, want %q", tt.filename, track.Filename, tt.want)
+		}
+		if got := buf.Len() > 0; got != tt.plan {
+			t.Errorf("transcodeTrack(%q) planned %q, want an encode: %t", tt.filename, buf.String(), tt.plan)
+		}
+		if tt.plan && !strings.Contains(buf.String(), encodedDir+"lesson01-") {
+			t.Errorf("transcodeTrack(%q) planned %q, want it encoded to a hashed name in %q", tt.filename, buf.String(), encodedDir)
+		}
+	}
+}
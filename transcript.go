@@ -0,0 +1,356 @@
+package main
+
+// transcript: .srt, .vtt and .txt transcripts, in the feed, and as ID3 USLT and SYLT frames
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bogem/id3v2"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	transcriptDescription = "Transcript"
+	syltTimestampMS       = 2 // SYLT's timestamp format: milliseconds
+	syltContentLyrics     = 1 // SYLT's content type: lyrics
+	vttHeader             = "WEBVTT"
+)
+
+// transcriptExtensions are the transcripts' extensions, in the order they are
+// looked for, next to the tracks
+var transcriptExtensions = []string{".vtt", ".srt", ".txt"}
+
+// Cue is a caption's text, and when it is shown
+type Cue struct {
+	Start int64 // milliseconds
+	End   int64 // milliseconds
+	Text  string
+}
+
+// Transcript is a transcript file of a track
+type Transcript struct {
+	Filename string
+	// Text is the transcript's plain text
+	Text string
+	// Cues are the transcript's captions, if it is an .srt or .vtt file
+	Cues []Cue
+}
+
+// isCaptions returns true if filename is an .srt or .vtt file
+func isCaptions(filename string) bool {
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".srt", ".vtt":
+		return true
+	}
+	return false
+}
+
+// parseCaptionFormats parses the captions field: "srt, vtt", into ".srt", ".vtt"
+func parseCaptionFormats(s string) (formats []string, err error) {
+	for _, format := range strings.Split(s, ",") {
+		format = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(format), "."))
+		switch format {
+		case "":
+			continue
+		case "srt", "vtt":
+			formats = append(formats, "."+format)
+		default:
+			return nil, fmt.Errorf("%q is not srt or vtt", format)
+		}
+	}
+	return formats, nil
+}
+
+// "00:01:02,500 --> 00:01:04.000 align:start"
+var cueTimingRegex = regexp.MustCompile(`^\s*(\S+)\s+-->\s+(\S+)`)
+
+// parseCueTime parses hh:mm:ss,mmm, hh:mm:ss.mmm, or mm:ss.mmm, into milliseconds
+func parseCueTime(s string) (int64, error) {
+	s = strings.Replace(s, ",", ".", 1)
+	var ms int64
+	if i := strings.Index(s, "."); i >= 0 {
+		n, err := strconv.ParseInt((s[i+1:] + "00")[:3], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid time %q", s)
+		}
+		ms = n
+		s = s[:i]
+	}
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	var seconds int64
+	for _, part := range parts {
+		n, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid time %q", s)
+		}
+		seconds = seconds*60 + n
+	}
+	return seconds*1000 + ms, nil
+}
+
+var cueBlockRegex = regexp.MustCompile(`\n\s*\n`)
+
+// parseCaptions parses an .srt or .vtt file's cues. The blocks without a
+// timing line (WEBVTT, NOTE, STYLE, etc.) are skipped
+func parseCaptions(data []byte) (cues []Cue, err error) {
+	s := strings.TrimPrefix(string(data), "\ufeff")
+	s = strings.Replace(s, "\r\n", "\n", -1)
+	for _, block := range cueBlockRegex.Split(s, -1) {
+		lines := strings.Split(strings.Trim(block, "\n"), "\n")
+		for i, line := range lines {
+			b := cueTimingRegex.FindStringSubmatch(line)
+			if b == nil {
+				continue
+			}
+			var cue Cue
+			cue.Start, err = parseCueTime(b[1])
+			if err != nil {
+				return nil, err
+			}
+			cue.End, err = parseCueTime(b[2])
+			if err != nil {
+				return nil, err
+			}
+			cue.Text = strings.TrimSpace(strings.Join(lines[i+1:], "\n"))
+			cues = append(cues, cue)
+			break
+		}
+	}
+	return cues, nil
+}
+
+// formatCueTime returns ms as hh:mm:ss,mmm, with sep as the decimal separator
+func formatCueTime(ms int64, sep string) string {
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, sep, ms%1000)
+}
+
+// "<v Jane>", "<b>", "{\an8}", etc.
+var cueTagRegex = regexp.MustCompile(`<(/?)([a-zA-Z]*)[^>]*>|\{\\[^}]*\}`)
+
+// convertCueText returns text with only the markup both .srt and .vtt
+// files support: <b>, <i> and <u>
+func convertCueText(text string) string {
+	return cueTagRegex.ReplaceAllStringFunc(text, func(tag string) string {
+		b := cueTagRegex.FindStringSubmatch(tag)
+		switch strings.ToLower(b[2]) {
+		case "b", "i", "u":
+			return "<" + b[1] + strings.ToLower(b[2]) + ">"
+		}
+		return ""
+	})
+}
+
+// formatSRT returns cues as an .srt file
+func formatSRT(cues []Cue) []byte {
+	var buf bytes.Buffer
+	for i, cue := range cues {
+		fmt.Fprintf(&buf, "%d\n%s --> %s\n%s\n\n", i+1, formatCueTime(cue.Start, ","), formatCueTime(cue.End, ","), convertCueText(cue.Text))
+	}
+	return buf.Bytes()
+}
+
+// formatVTT returns cues as a .vtt file
+func formatVTT(cues []Cue) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(vttHeader + "\n\n")
+	for _, cue := range cues {
+		fmt.Fprintf(&buf, "%s --> %s\n%s\n\n", formatCueTime(cue.Start, "."), formatCueTime(cue.End, "."), convertCueText(cue.Text))
+	}
+	return buf.Bytes()
+}
+
+// cueText returns the cue's text without its markup, on one line
+func cueText(cue Cue) string {
+	return strings.Join(strings.Fields(cueTagRegex.ReplaceAllString(cue.Text, "")), " ")
+}
+
+// readTranscript reads, and, if it is an .srt or .vtt file, parses, filename
+func readTranscript(filename string) (*Transcript, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	t := &Transcript{Filename: filename}
+	if !isCaptions(filename) {
+		t.Text = strings.TrimSpace(strings.TrimPrefix(string(data), "\ufeff"))
+		return t, nil
+	}
+	t.Cues, err = parseCaptions(data)
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for _, cue := range t.Cues {
+		if text := cueText(cue); text != "" {
+			lines = append(lines, text)
+		}
+	}
+	t.Text = strings.Join(lines, "\n")
+	return t, nil
+}
+
+// setTrackTranscripts reads the transcript column, if it is a local file, or
+// else <name>.vtt, .srt and .txt, if they exist. A transcript column with a
+// URL is left as is
+func setTrackTranscripts(track *Track) {
+	track.Transcripts = nil
+	var filenames []string
+	if track.Transcript != "" {
+		if strings.Contains(track.Transcript, "://") {
+			return
+		}
+		if _, err := os.Stat(track.Transcript); err != nil {
+			// already in output_dir, or on the web site
+			return
+		}
+		filenames = append(filenames, track.Transcript)
+	} else {
+		for _, ext := range transcriptExtensions {
+			filename := basename(track.Filename) + ext
+			if _, err := os.Stat(filename); err == nil {
+				filenames = append(filenames, filename)
+			}
+		}
+	}
+	for _, filename := range filenames {
+		t, err := readTranscript(filename)
+		if err != nil {
+			log.Warnf("Cannot read %q: %s", filename, err)
+			continue
+		}
+		log.Debugf("Read transcript %q for %q", filename, track.Filename)
+		track.Transcripts = append(track.Transcripts, t)
+	}
+}
+
+// transcriptText returns the track's plain text transcript, preferring a
+// .txt file to the captions
+func transcriptText(track *Track) string {
+	var text string
+	for _, t := range track.Transcripts {
+		if text == "" || !isCaptions(t.Filename) {
+			text = t.Text
+		}
+	}
+	return text
+}
+
+// transcriptCues returns the cues of the track's first .srt or .vtt transcript
+func transcriptCues(track *Track) []Cue {
+	for _, t := range track.Transcripts {
+		if len(t.Cues) > 0 {
+			return t.Cues
+		}
+	}
+	return nil
+}
+
+// syltFrame returns cues as a SYLT (synchronised lyrics/text) frame, which
+// id3v2 does not support
+func syltFrame(cues []Cue, language string) id3v2.UnknownFrame {
+	body := []byte{id3v2.EncodingUTF8.Key}
+	body = append(body, language...)
+	body = append(body, syltTimestampMS, syltContentLyrics)
+	body = append(body, transcriptDescription...)
+	body = append(body, 0)
+	for _, cue := range cues {
+		body = append(body, cueText(cue)...)
+		body = append(body, 0)
+		body = append(body, byte(cue.Start>>24), byte(cue.Start>>16), byte(cue.Start>>8), byte(cue.Start))
+	}
+	return id3v2.UnknownFrame{Body: body}
+}
+
+// addTranscriptFrames adds the track's transcript to tag, as a USLT frame,
+// and, if transcript_sylt is true, as a SYLT frame
+func addTranscriptFrames(tag *id3v2.Tag, track *Track) {
+	text := transcriptText(track)
+	if text == "" {
+		return
+	}
+	language := bCF47ToISO3(defaults.Language)
+	tag.AddUnsynchronisedLyricsFrame(id3v2.UnsynchronisedLyricsFrame{
+		Encoding:          id3v2.EncodingUTF8,
+		Language:          language,
+		ContentDescriptor: transcriptDescription,
+		Lyrics:            text,
+	})
+	if cues := transcriptCues(track); defaults.transcriptSYLT && len(cues) > 0 {
+		tag.AddFrame("SYLT", syltFrame(cues, language))
+	}
+}
+
+// transcriptFile is a transcript file in output_dir
+type transcriptFile struct {
+	Name string
+	From *Transcript
+}
+
+// transcriptFiles returns the track's transcripts in output_dir, adding
+// its captions converted to the formats in captions
+func transcriptFiles(track *Track) (files []transcriptFile) {
+	formats := map[string]bool{}
+	for _, t := range track.Transcripts {
+		formats[strings.ToLower(path.Ext(t.Filename))] = true
+	}
+	name := basename(path.Base(track.OutputName))
+	for _, t := range track.Transcripts {
+		files = append(files, transcriptFile{name + strings.ToLower(path.Ext(t.Filename)), t})
+		if !isCaptions(t.Filename) {
+			continue
+		}
+		for _, ext := range defaults.captions {
+			if !formats[ext] {
+				formats[ext] = true
+				files = append(files, transcriptFile{name + ext, t})
+			}
+		}
+	}
+	return files
+}
+
+// writeTranscripts saves the transcripts of the tracks in outputDir,
+// converting them, as needed
+func writeTranscripts(tracks []*Track, outputDir string) {
+	for _, track := range tracks {
+		if !track.IsValid() {
+			continue
+		}
+		for _, f := range transcriptFiles(track) {
+			var data []byte
+			switch ext := path.Ext(f.Name); {
+			case strings.EqualFold(ext, path.Ext(f.From.Filename)):
+				var err error
+				data, err = ioutil.ReadFile(f.From.Filename)
+				if err != nil {
+					log.Fatalf("Cannot read %q: %s", f.From.Filename, err)
+				}
+			case ext == ".srt":
+				data = formatSRT(f.From.Cues)
+			default:
+				data = formatVTT(f.From.Cues)
+			}
+
+			filename := outputDir + f.Name
+			if dryRun {
+				planFeed(filename, data)
+				continue
+			}
+			log.Infof("Creating %q", filename)
+			err := ioutil.WriteFile(filename, data, 0644)
+			if err != nil {
+				log.Fatalf("Cannot write %q: %s", filename, err)
+			}
+		}
+	}
+}
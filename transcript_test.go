@@ -0,0 +1,49 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCaptions(t *testing.T) {
+	srt := "\ufeff1\r\n00:00:01,000 --> 00:00:03,500\r\n<i>Hello</i>\r\nworld\r\n\r\n2\r\n01:02:03,004 --> 01:02:04,000\r\nBye\r\n"
+	vtt := "WEBVTT\n\nNOTE a comment\n\nintro\n00:01.000 --> 00:03.500 align:start\n<i>Hello</i>\nworld\n\n01:02:03.004 --> 01:02:04.000\nBye\n"
+	want := []Cue{
+		{Start: 1000, End: 3500, Text: "<i>Hello</i>\nworld"},
+		{Start: 3723004, End: 3724000, Text: "Bye"},
+	}
+	for _, data := range []string{srt, vtt} {
+		got, err := parseCaptions([]byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("parseCaptions(%q) = %+v, want %+v", data, got, want)
+		}
+	}
+
+	got, err := parseCaptions(formatSRT(want))
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("parseCaptions(formatSRT()) = %+v, %v, want %+v", got, err, want)
+	}
+	got, err = parseCaptions(formatVTT(want))
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("parseCaptions(formatVTT()) = %+v, %v, want %+v", got, err, want)
+	}
+}
+
+func TestConvertCueText(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"<v Jane>Hi <B>there</B>", "Hi <b>there</b>"},
+		{"{\\an8}<font color=\"red\">Top</font>", "Top"},
+		{"<c.loud>Hey</c>", "Hey"},
+	}
+	for _, tt := range tests {
+		if got := convertCueText(tt.text); got != tt.want {
+			t.Errorf("convertCueText(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"os/exec"
 	"path"
@@ -11,7 +12,9 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"time"
 
+	fpodcast "github.com/rasa/feedster/podcast"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/text/language"
 )
@@ -37,6 +40,198 @@ func bCF47ToISO3(BCF47 string) string {
 	return base.ISO3()
 }
 
+// getEnclosureType returns the enclosure type of filename, based on its
+// contents, or, if that is inconclusive, its extension
+func getEnclosureType(filename string) fpodcast.EnclosureType {
+	ext := strings.ToLower(path.Ext(filename))
+
+	b := make([]byte, 12)
+	fh, err := os.Open(filename)
+	if err == nil {
+		_, err = io.ReadFull(fh, b)
+		fh.Close()
+	}
+	if err == nil {
+		if string(b[4:8]) == "ftyp" {
+			switch string(b[8:12]) {
+			case "M4A ", "M4B ", "M4P ":
+				return fpodcast.M4A
+			case "M4V ", "M4VH", "M4VP":
+				return fpodcast.M4V
+			case "qt  ":
+				return fpodcast.MOV
+			}
+			switch ext {
+			case ".m4a", ".m4b":
+				return fpodcast.M4A
+			case ".m4v":
+				return fpodcast.M4V
+			case ".mov":
+				return fpodcast.MOV
+			}
+			return fpodcast.MP4
+		}
+		if string(b[0:3]) == "ID3" {
+			if ext == ".aac" {
+				// an ID3 tag, followed by ADTS frames
+				return fpodcast.AAC
+			}
+			return fpodcast.MP3
+		}
+		if isADTS(b) {
+			return fpodcast.AAC
+		}
+		if _, ok := parseMpegFrame(b); ok {
+			return fpodcast.MP3
+		}
+		if string(b[0:4]) == "%PDF" {
+			return fpodcast.PDF
+		}
+	}
+
+	switch ext {
+	case ".m4a", ".m4b":
+		return fpodcast.M4A
+	case ".aac":
+		return fpodcast.AAC
+	case ".m4v":
+		return fpodcast.M4V
+	case ".mp4":
+		return fpodcast.MP4
+	case ".mov":
+		return fpodcast.MOV
+	case ".pdf":
+		return fpodcast.PDF
+	case ".epub":
+		return fpodcast.EPUB
+	}
+	return fpodcast.MP3
+}
+
+// isADTS returns true if b starts with an ADTS (raw AAC) frame header: a
+// 12 bit sync word, like MPEG audio's, but with a layer of 0
+func isADTS(b []byte) bool {
+	return len(b) >= 2 && b[0] == 0xff && b[1]&0xf6 == 0xf0
+}
+
+// isMP4 returns true if the enclosure type uses the MP4 container
+func isMP4(enclosureType fpodcast.EnclosureType) bool {
+	switch enclosureType {
+	case fpodcast.M4A, fpodcast.M4V, fpodcast.MP4, fpodcast.MOV:
+		return true
+	}
+	return false
+}
+
+// absoluteURL returns s if it is an absolute URL, otherwise s relative to base_url
+func absoluteURL(s string) string {
+	if strings.Contains(s, "://") {
+		return s
+	}
+	return defaults.BaseURL + strings.TrimPrefix(s, "/")
+}
+
+// transcriptType returns the MIME type of a transcript, based on its extension
+func transcriptType(filename string) string {
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".srt":
+		return "application/srt"
+	case ".vtt":
+		return "text/vtt"
+	case ".json":
+		return "application/json"
+	case ".html", ".htm":
+		return "text/html"
+	}
+	return "text/plain"
+}
+
+// contentTypes are the MIME types of the files feedster writes, by extension
+var contentTypes = map[string]string{
+	".aac":  "audio/aac",
+	".atom": "application/atom+xml; charset=utf-8",
+	".epub": "application/epub+zip",
+	".html": "text/html; charset=utf-8",
+	".jpeg": "image/jpeg",
+	".jpg":  "image/jpeg",
+	".json": "application/json",
+	".m4a":  "audio/x-m4a",
+	".m4v":  "video/x-m4v",
+	".mov":  "video/quicktime",
+	".mp3":  "audio/mpeg",
+	".mp4":  "video/mp4",
+	".pdf":  "application/pdf",
+	".png":  "image/png",
+	".srt":  "application/srt",
+	".txt":  "text/plain; charset=utf-8",
+	".vtt":  "text/vtt",
+	".xml":  "application/rss+xml; charset=utf-8",
+}
+
+// contentType returns the MIME type of filename, based on its extension
+func contentType(filename string) string {
+	if t, ok := contentTypes[strings.ToLower(path.Ext(filename))]; ok {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// pubDateLayouts are the date formats accepted in the pubdate column
+var pubDateLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	// Excel's (US) default display format for dates: month/day/year
+	"1/2/2006",
+	"1/2/2006 15:04",
+}
+
+// excelEpoch is day 0 of Excel's (1900) date system
+var excelEpoch = time.Date(1899, time.December, 30, 0, 0, 0, 0, time.UTC)
+
+// parsePubDate parses s as an RFC1123, ISO-8601, yyyy-mm-dd, m/d/yyyy or Excel serial date.
+// Dates without a timezone are in loc
+func parsePubDate(s string, loc *time.Location) (t time.Time, err error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range pubDateLayouts {
+		t, err = time.ParseInLocation(layout, s, loc)
+		if err == nil {
+			return t, nil
+		}
+	}
+
+	serial, err := strconv.ParseFloat(s, 64)
+	if err == nil && serial >= 1 && serial < 2958466 {
+		days := int(serial)
+		t = excelEpoch.AddDate(0, 0, days)
+		t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+		seconds := math.Round((serial - float64(days)) * 24 * 60 * 60)
+		return t.Add(time.Duration(seconds) * time.Second), nil
+	}
+
+	return time.Time{}, fmt.Errorf("Cannot parse pubdate %q", s)
+}
+
+// lengthRegex matches hh:mm:ss, mm:ss or ss, with optional milliseconds
+var lengthRegex = regexp.MustCompile(`^\d+(?::\d{1,2}){0,2}(?:\.\d{1,3})?$`)
+
+// parseLength parses s, the length column, as hh:mm:ss, mm:ss or ss, with
+// optional milliseconds, and returns it in milliseconds
+func parseLength(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if !lengthRegex.MatchString(s) {
+		return 0, fmt.Errorf("Cannot parse length %q: it is not hh:mm:ss", s)
+	}
+	return parseChapterTime(s), nil
+}
+
 // From: https://stackoverflow.com/a/21067803
 
 func copyFile(src, dst string) (err error) {
@@ -80,6 +275,22 @@ func copyFile(src, dst string) (err error) {
 	return
 }
 
+// upToDate returns true if dst has the same size and modification time as src
+func upToDate(src, dst string) bool {
+	sfi, err := os.Stat(src)
+	if err != nil {
+		return false
+	}
+	dfi, err := os.Stat(dst)
+	if err != nil {
+		return false
+	}
+	if os.SameFile(sfi, dfi) {
+		return false
+	}
+	return sfi.Size() == dfi.Size() && sfi.ModTime().Equal(dfi.ModTime())
+}
+
 // copyFileContents copies the contents of the file named src to the file named
 // by dst. The file will be created if it does not already exist. If the
 // destination file exists, all it's contents will be replaced by the contents
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	fpodcast "github.com/rasa/feedster/podcast"
+)
+
+func TestParsePubDate(t *testing.T) {
+	loc := time.FixedZone("EST", -5*60*60)
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"Tue, 06 Nov 2018 15:15:00 +0000", time.Date(2018, 11, 6, 15, 15, 0, 0, time.UTC)},
+		{"Tue, 6 Nov 2018 15:15:00 -0500", time.Date(2018, 11, 6, 15, 15, 0, 0, loc)},
+		{"2018-11-06T15:15:00Z", time.Date(2018, 11, 6, 15, 15, 0, 0, time.UTC)},
+		{"2018-11-06T15:15:00", time.Date(2018, 11, 6, 15, 15, 0, 0, loc)},
+		{"2018-11-06", time.Date(2018, 11, 6, 0, 0, 0, 0, loc)},
+		{"43410", time.Date(2018, 11, 6, 0, 0, 0, 0, loc)},
+		{"43410.5", time.Date(2018, 11, 6, 12, 0, 0, 0, loc)},
+		{"11/6/2018", time.Date(2018, 11, 6, 0, 0, 0, 0, loc)},
+		{"11/6/2018 15:15", time.Date(2018, 11, 6, 15, 15, 0, 0, loc)},
+	}
+	for _, tt := range tests {
+		got, err := parsePubDate(tt.in, loc)
+		if err != nil {
+			t.Errorf("parsePubDate(%q): %s", tt.in, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("parsePubDate(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+
+	for _, s := range []string{"next tuesday", "11-06-18"} {
+		if _, err := parsePubDate(s, loc); err == nil {
+			t.Errorf("parsePubDate(%q): expected an error", s)
+		}
+	}
+}
+
+func TestParseLength(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"1:02:03", 3723000},
+		{"01:02:03.5", 3723500},
+		{" 52:10 ", 3130000},
+		{"90", 90000},
+		{"0:00:01.250", 1250},
+	}
+	for _, tt := range tests {
+		got, err := parseLength(tt.in)
+		if err != nil {
+			t.Errorf("parseLength(%q): %s", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseLength(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+
+	for _, s := range []string{"", "1:2x:00", "1:02:03:04", "1h02m", "-1:00", "1:02.5000"} {
+		if _, err := parseLength(s); err == nil {
+			t.Errorf("parseLength(%q): expected an error", s)
+		}
+	}
+}
+
+func TestGetEnclosureType(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		data []byte
+		want fpodcast.EnclosureType
+	}{
+		{"adts.aac", []byte{0xff, 0xf1, 0x50, 0x80, 0x02, 0x1f, 0xfc, 0, 0, 0, 0, 0}, fpodcast.AAC},
+		{"id3.aac", []byte("ID3\x04\x00\x00\x00\x00\x00\x00\x00\x00"), fpodcast.AAC},
+		{"id3.mp3", []byte("ID3\x04\x00\x00\x00\x00\x00\x00\x00\x00"), fpodcast.MP3},
+		{"mpeg.aac", []byte{0xff, 0xfb, 0x90, 0x64, 0, 0, 0, 0, 0, 0, 0, 0}, fpodcast.MP3},
+		{"mp4.aac", []byte("\x00\x00\x00\x20ftypM4A "), fpodcast.M4A},
+		{"empty.aac", nil, fpodcast.AAC},
+	}
+	for _, tt := range tests {
+		filename := filepath.Join(dir, tt.name)
+		if err := ioutil.WriteFile(filename, tt.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if got := getEnclosureType(filename); got != tt.want {
+			t.Errorf("getEnclosureType(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+		if got := isMP4(getEnclosureType(filename)); got != (tt.want == fpodcast.M4A) {
+			t.Errorf("isMP4(%q) = %v", tt.name, got)
+		}
+	}
+}
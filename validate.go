@@ -0,0 +1,312 @@
+package main
+
+// feedster validate: check feeds against the Apple Podcasts and Spotify requirements
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	fpodcast "github.com/rasa/feedster/podcast"
+	log "github.com/sirupsen/logrus"
+)
+
+// https://podcasters.apple.com/support/823-podcast-requirements
+// https://podcasters.spotify.com/terms/Spotify_Podcast_Delivery_Specification_v1.9.pdf
+const (
+	descriptionLengthMax = 4000
+	subtitleLengthMax    = 255
+	summaryLengthMax     = 4000
+)
+
+// Validation holds the problems found in a feed
+type Validation struct {
+	Errors   []string
+	Warnings []string
+}
+
+// validation is set while running feedster validate, so processYAML checks
+// the podcast, instead of saving it
+var validation *Validation
+
+func (v *Validation) errorf(format string, args ...interface{}) {
+	v.Errors = append(v.Errors, fmt.Sprintf(format, args...))
+}
+
+func (v *Validation) warnf(format string, args ...interface{}) {
+	v.Warnings = append(v.Warnings, fmt.Sprintf(format, args...))
+}
+
+// validExplicit returns true if s is a value Apple accepts for itunes:explicit
+func validExplicit(s string) bool {
+	switch strings.ToLower(s) {
+	case "true", "false", "yes", "no", "clean":
+		return true
+	}
+	return false
+}
+
+// validURL returns true if s is an absolute http or https URL
+func validURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// Podcast checks p. If imageDir is not empty, the artwork is read from it,
+// and, if mediaDir is not empty, the enclosures' lengths are compared with
+// the files in mediaDir
+func (v *Validation) Podcast(p *fpodcast.Podcast, imageDir string, mediaDir string) {
+	if p.Title == "" {
+		v.errorf("channel: title is required")
+	}
+	if p.Description == "" {
+		v.errorf("channel: description is required")
+	}
+	if len(p.Description) > descriptionLengthMax {
+		v.errorf("channel: description is %d characters, %d is the maximum", len(p.Description), descriptionLengthMax)
+	}
+	if p.Link == "" {
+		v.warnf("channel: link is recommended")
+	}
+	if p.Language == "" {
+		v.errorf("channel: language is required")
+	}
+	if p.IAuthor == "" {
+		v.warnf("channel: itunes:author is recommended")
+	}
+	if p.IOwner == nil || p.IOwner.Email == "" {
+		v.warnf("channel: itunes:owner's email is needed to verify ownership with Spotify")
+	}
+	if p.IExplicit == "" {
+		v.errorf("channel: itunes:explicit is required")
+	} else if !validExplicit(p.IExplicit) {
+		v.errorf("channel: itunes:explicit is %q, it must be true or false", p.IExplicit)
+	}
+	if len(p.ISubtitle) > subtitleLengthMax {
+		v.warnf("channel: itunes:subtitle is %d characters, %d is the maximum", len(p.ISubtitle), subtitleLengthMax)
+	}
+	if p.ISummary != nil && len(p.ISummary.Text) > summaryLengthMax {
+		v.errorf("channel: itunes:summary is %d characters, %d is the maximum", len(p.ISummary.Text), summaryLengthMax)
+	}
+
+	if len(p.ICategories) == 0 {
+		v.errorf("channel: itunes:category is required")
+	}
+	for _, c := range p.ICategories {
+		if err := categoryError(c.Text, ""); err != nil {
+			v.errorf("channel: itunes:category %s", err)
+			continue
+		}
+		for _, sc := range c.ICategories {
+			if err := categoryError(c.Text, sc.Text); err != nil {
+				v.errorf("channel: itunes:category %s", err)
+			}
+		}
+	}
+
+	if p.IImage == nil || p.IImage.HREF == "" {
+		v.errorf("channel: itunes:image is required")
+	} else {
+		v.image(p.IImage.HREF, imageDir)
+	}
+
+	if len(p.Items) == 0 {
+		v.errorf("channel: at least one item is required")
+	}
+	seen := make(map[string]int)
+	for n, item := range p.Items {
+		v.item(item, n+1, seen, mediaDir)
+	}
+}
+
+// image checks the artwork published at href, and, if imageDir is not empty,
+// the file in imageDir
+func (v *Validation) image(href string, imageDir string) {
+	if !validURL(href) {
+		v.errorf("channel: itunes:image %q is not an http or https URL", href)
+	}
+	ext := strings.ToLower(path.Ext(href))
+	if ext != ".jpg" && ext != ".jpeg" && ext != ".png" {
+		v.errorf("channel: itunes:image %q must be a .jpg or .png file", href)
+	}
+
+	if imageDir == "" {
+		return
+	}
+	filename := filepath.Join(imageDir, path.Base(href))
+	fh, err := os.Open(filename)
+	if err != nil {
+		v.warnf("channel: cannot check itunes:image: %s", err)
+		return
+	}
+	defer fh.Close()
+	v.imageConfig(filename, fh)
+}
+
+// imageConfig checks the artwork read from r
+func (v *Validation) imageConfig(filename string, r io.Reader) {
+	config, format, err := image.DecodeConfig(r)
+	if err != nil {
+		v.errorf("channel: cannot read itunes:image %q: %s", filename, err)
+		return
+	}
+	if format != "jpeg" && format != "png" {
+		v.errorf("channel: itunes:image %q is a %s image, it must be a JPEG or PNG", filename, format)
+	}
+	if config.Width != config.Height {
+		v.errorf("channel: itunes:image %q is %dx%d, it must be square", filename, config.Width, config.Height)
+	}
+	if config.Width < imageWidthMin || config.Height < imageHeightMin ||
+		config.Width > imageWidthMax || config.Height > imageHeightMax {
+		v.errorf("channel: itunes:image %q is %dx%d, it must be between %dx%d and %dx%d",
+			filename, config.Width, config.Height, imageWidthMin, imageHeightMin, imageWidthMax, imageHeightMax)
+	}
+	switch config.ColorModel {
+	case color.CMYKModel, color.GrayModel, color.Gray16Model:
+		v.errorf("channel: itunes:image %q must be in the RGB color space", filename)
+	}
+}
+
+// item checks the n'th item. seen holds the items' GUIDs seen so far
+func (v *Validation) item(item *fpodcast.Item, n int, seen map[string]int, mediaDir string) {
+	where := fmt.Sprintf("item %d", n)
+	if item.Title == "" {
+		v.errorf("%s: title is required", where)
+	} else {
+		where = fmt.Sprintf("item %d (%q)", n, item.Title)
+	}
+
+	e := item.Enclosure
+	if e == nil || e.URL == "" {
+		v.errorf("%s: enclosure is required", where)
+	} else {
+		if !validURL(e.URL) {
+			v.errorf("%s: enclosure URL %q is not an http or https URL", where, e.URL)
+		}
+		if et, ok := fpodcast.ParseEnclosureType(e.TypeFormatted); !ok {
+			v.errorf("%s: enclosure type %q is not supported", where, e.TypeFormatted)
+		} else if et == fpodcast.AAC {
+			v.warnf("%s: enclosure type %q is not supported by Apple Podcasts (use .m4a files)", where, e.TypeFormatted)
+		}
+		length, err := strconv.ParseInt(e.LengthFormatted, 10, 64)
+		if err != nil || length <= 0 {
+			v.errorf("%s: enclosure length %q must be the file's size in bytes", where, e.LengthFormatted)
+		} else if mediaDir != "" {
+			filename := filepath.Join(mediaDir, path.Base(e.URL))
+			fi, err := os.Stat(filename)
+			if err != nil {
+				v.warnf("%s: cannot check enclosure length: %s", where, err)
+			} else if fi.Size() != length {
+				v.errorf("%s: enclosure length is %d, but %q is %d bytes", where, length, filename, fi.Size())
+			}
+		}
+	}
+
+	guid := ""
+	if item.GUIDFormatted != nil {
+		guid = item.GUIDFormatted.Text
+	}
+	if guid == "" {
+		v.warnf("%s: guid is recommended", where)
+	} else if other, ok := seen[guid]; ok {
+		v.errorf("%s: guid %q is also used by item %d", where, guid, other)
+	} else {
+		seen[guid] = n
+	}
+
+	if item.IExplicit != "" && !validExplicit(item.IExplicit) {
+		v.errorf("%s: itunes:explicit is %q, it must be true or false", where, item.IExplicit)
+	}
+	switch item.IEpisodeType {
+	case "", "full", "trailer", "bonus":
+	default:
+		v.errorf("%s: itunes:episodeType is %q, it must be full, trailer or bonus", where, item.IEpisodeType)
+	}
+	for _, number := range []struct{ name, value string }{
+		{"itunes:season", item.ISeason},
+		{"itunes:episode", item.IEpisode},
+	} {
+		if number.value == "" {
+			continue
+		}
+		i, err := strconv.Atoi(number.value)
+		if err != nil || i <= 0 {
+			v.errorf("%s: %s is %q, it must be a positive integer", where, number.name, number.value)
+		}
+	}
+	if item.IDuration != "" && !regexp.MustCompile(`^(\d+:)?(\d+:)?\d+$`).MatchString(item.IDuration) {
+		v.warnf("%s: itunes:duration %q must be seconds, or hh:mm:ss", where, item.IDuration)
+	}
+
+	if len(item.Description) > descriptionLengthMax {
+		v.errorf("%s: description is %d characters, %d is the maximum", where, len(item.Description), descriptionLengthMax)
+	}
+	if len(item.ISubtitle) > subtitleLengthMax {
+		v.warnf("%s: itunes:subtitle is %d characters, %d is the maximum", where, len(item.ISubtitle), subtitleLengthMax)
+	}
+	if item.ISummary != nil && len(item.ISummary.Text) > summaryLengthMax {
+		v.errorf("%s: itunes:summary is %d characters, %d is the maximum", where, len(item.ISummary.Text), summaryLengthMax)
+	}
+}
+
+// Report prints the problems found in name, and returns false if there were errors
+func (v *Validation) Report(name string) bool {
+	for _, s := range v.Errors {
+		fmt.Printf("%s: error: %s\n", name, s)
+	}
+	for _, s := range v.Warnings {
+		fmt.Printf("%s: warning: %s\n", name, s)
+	}
+	fmt.Printf("%s: %d errors, %d warnings\n", name, len(v.Errors), len(v.Warnings))
+	return len(v.Errors) == 0
+}
+
+// validateXML checks the feed in filename, and the files next to it
+func validateXML(filename string) {
+	fh, err := os.Open(filename)
+	if err != nil {
+		log.Fatalf("Cannot open %q: %s", filename, err)
+	}
+	defer fh.Close()
+	p, err := fpodcast.Decode(fh)
+	if err != nil {
+		validation.errorf("cannot parse feed: %s", err)
+		return
+	}
+	dir := filepath.Dir(filename)
+	validation.Podcast(p, dir, dir)
+}
+
+// validate checks each of the feeds (.xml) or projects (.yaml) in args, and
+// returns the exit code: 1 if any of them have errors
+func validate(args []string) int {
+	if len(args) == 0 {
+		args = []string{defaultYAML}
+	}
+	rv := 0
+	for _, arg := range args {
+		validation = &Validation{}
+		if strings.EqualFold(filepath.Ext(arg), ".xml") {
+			validateXML(arg)
+		} else {
+			// build the podcast in memory, without writing anything
+			dryRun = true
+			planOutput = ioutil.Discard
+			processYAML(arg)
+		}
+		if !validation.Report(arg) {
+			rv = 1
+		}
+	}
+	validation = nil
+	return rv
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	fpodcast "github.com/rasa/feedster/podcast"
+)
+
+const testFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd">
+  <channel>
+    <title>Test</title>
+    <link>https://example.com/</link>
+    <description>A test</description>
+    <language>en-us</language>
+    <itunes:author>Jane Doe</itunes:author>
+    <itunes:explicit>maybe</itunes:explicit>
+    <itunes:image href="https://example.com/test.jpg"></itunes:image>
+    <itunes:category text="Education">
+      <itunes:category text="Cooking"></itunes:category>
+    </itunes:category>
+    <item>
+      <guid>1</guid>
+      <title>One</title>
+      <enclosure url="https://example.com/one.mp3" length="1234" type="audio/mpeg"></enclosure>
+      <itunes:episodeType>full</itunes:episodeType>
+    </item>
+    <item>
+      <guid>1</guid>
+      <title>Two</title>
+      <enclosure url="https://example.com/two.ogg" length="" type="audio/ogg"></enclosure>
+      <itunes:episodeType>extra</itunes:episodeType>
+    </item>
+    <item>
+      <guid>3</guid>
+      <title>Three</title>
+      <enclosure url="https://example.com/three.aac" length="1234" type="audio/aac"></enclosure>
+    </item>
+  </channel>
+</rss>`
+
+func TestValidation(t *testing.T) {
+	p, err := fpodcast.Decode(strings.NewReader(testFeed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.IImage == nil || len(p.ICategories) != 1 || len(p.Items) != 3 {
+		t.Fatalf("Decode() did not read the itunes: elements: %+v", p)
+	}
+
+	v := &Validation{}
+	v.Podcast(p, t.TempDir(), "")
+
+	want := []string{
+		`itunes:explicit is "maybe"`,
+		`"Cooking" is not a subcategory of "Education"`,
+		`item 2 ("Two"): enclosure type "audio/ogg"`,
+		`item 2 ("Two"): enclosure length ""`,
+		`item 2 ("Two"): guid "1" is also used by item 1`,
+		`item 2 ("Two"): itunes:episodeType is "extra"`,
+	}
+	errors := strings.Join(v.Errors, "\n")
+	for _, w := range want {
+		if !strings.Contains(errors, w) {
+			t.Errorf("missing error %q in:\n%s", w, errors)
+		}
+	}
+	if len(v.Errors) != len(want) {
+		t.Errorf("got %d errors, want %d:\n%s", len(v.Errors), len(want), errors)
+	}
+
+	// feedster writes raw AAC files' enclosures, but Apple doesn't support them
+	warning := `item 3 ("Three"): enclosure type "audio/aac" is not supported by Apple Podcasts`
+	if warnings := strings.Join(v.Warnings, "\n"); !strings.Contains(warnings, warning) {
+		t.Errorf("missing warning %q in:\n%s", warning, warnings)
+	}
+}